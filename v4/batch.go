@@ -0,0 +1,148 @@
+package ds
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNoBatchResults = errors.New("ds: no more results in batch")
+var ErrBatchClosed = errors.New("ds: batch results already closed")
+
+// BatchQuery is a statement queued in a Batch.
+type BatchQuery struct {
+	SQL  string
+	Args []any
+}
+
+// Batch queues statements sent together with SendBatch.
+// The zero value is an empty batch ready to use.
+type Batch struct {
+	queries []BatchQuery
+}
+
+// Queue appends a statement to the batch. sql may also be the
+// name of a statement prepared on the connection.
+func (b *Batch) Queue(sql string, args ...any) {
+	b.queries = append(b.queries, BatchQuery{SQL: sql, Args: args})
+}
+
+// Len returns the number of queued statements.
+func (b *Batch) Len() int {
+	return len(b.queries)
+}
+
+// Queries returns the queued statements in order.
+func (b *Batch) Queries() []BatchQuery {
+	return b.queries
+}
+
+// BatchResults reads the results of a sent batch, one call per queued
+// statement in queue order. Rows returned by Query must be closed before
+// the next result is read. Close must always be called; it reads the
+// remaining results and returns the first error of the batch.
+type BatchResults interface {
+	Exec() (ExecResult, error)
+	Query() (Rows, error)
+	QueryRow() Row
+	Close() error
+}
+
+// SendBatchSequential emulates SendBatch for providers that cannot
+// pipeline statements. Each statement is run on q when its result is
+// read, or by Close. After a statement fails, the remaining ones are
+// skipped and report its error. Outside a transaction every statement
+// commits on its own, so run the batch in a Tx to make it atomic.
+func SendBatchSequential(ctx context.Context, q Querier, b *Batch) BatchResults {
+	return &sequentialBatch{ctx: ctx, q: q, queries: b.Queries()}
+}
+
+type sequentialBatch struct {
+	ctx     context.Context
+	q       Querier
+	queries []BatchQuery
+	next    int
+	err     error
+	closed  bool
+}
+
+// take returns the next statement, or the error that ends the batch.
+func (b *sequentialBatch) take() (BatchQuery, error) {
+	if b.closed {
+		return BatchQuery{}, ErrBatchClosed
+	}
+	if b.next >= len(b.queries) {
+		return BatchQuery{}, ErrNoBatchResults
+	}
+
+	q := b.queries[b.next]
+	b.next++
+	if b.err != nil {
+		return BatchQuery{}, b.err
+	}
+	return q, nil
+}
+
+func (b *sequentialBatch) fail(err error) {
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *sequentialBatch) Exec() (ExecResult, error) {
+	q, err := b.take()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.q.Exec(b.ctx, q.SQL, q.Args...)
+	b.fail(err)
+	return res, err
+}
+
+func (b *sequentialBatch) Query() (Rows, error) {
+	q, err := b.take()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := b.q.Query(b.ctx, q.SQL, q.Args...)
+	b.fail(err)
+	return rows, err
+}
+
+func (b *sequentialBatch) QueryRow() Row {
+	q, err := b.take()
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &sequentialBatchRow{row: b.q.QueryRow(b.ctx, q.SQL, q.Args...), batch: b}
+}
+
+func (b *sequentialBatch) Close() error {
+	if b.closed {
+		return b.err
+	}
+
+	for b.next < len(b.queries) {
+		if _, err := b.Exec(); err != nil {
+			break
+		}
+	}
+	b.closed = true
+
+	return b.err
+}
+
+type sequentialBatchRow struct {
+	row   Row
+	batch *sequentialBatch
+}
+
+func (r *sequentialBatchRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if !errors.Is(err, ErrNoRows) {
+		r.batch.fail(err)
+	}
+	return err
+}
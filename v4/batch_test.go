@@ -0,0 +1,88 @@
+package ds_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+func TestSendBatchSequential(t *testing.T) {
+	expectedErr := errors.New("insert failed")
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`INSERT`).WithArgs("alice").WillReturnResult(1)
+	p.ExpectQuery(`SELECT count`).WillReturnRows(dstest.NewRows("count").AddRow(1))
+	p.ExpectExec(`INSERT`).WithArgs("bob").WillReturnError(expectedErr)
+
+	b := &ds.Batch{}
+	b.Queue("INSERT INTO users(name) VALUES($1)", "alice")
+	b.Queue("SELECT count(*) FROM users")
+	b.Queue("INSERT INTO users(name) VALUES($1)", "bob")
+	b.Queue("INSERT INTO users(name) VALUES($1)", "carol")
+
+	if b.Len() != 4 {
+		t.Fatalf("expected 4 queued statements, got %d", b.Len())
+	}
+
+	// Nothing runs until results are read.
+	br := primaryConn(t, p).SendBatch(context.Background(), b)
+
+	res, err := br.Exec()
+	if err != nil || res.RowsAffected() != 1 {
+		t.Fatalf("unexpected result: %v, %v", res, err)
+	}
+
+	var n int
+	if err := br.QueryRow().Scan(&n); err != nil || n != 1 {
+		t.Fatalf("unexpected count: %d, %v", n, err)
+	}
+
+	// Close runs bob, which fails, and skips carol.
+	if err := br.Close(); !errors.Is(err, expectedErr) {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+	if err := br.QueryRow().Scan(&n); !errors.Is(err, ds.ErrBatchClosed) {
+		t.Fatalf("expected ErrBatchClosed, got %v", err)
+	}
+}
+
+func TestWithHooksBatch(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`INSERT`).WillReturnResult(1)
+	p.ExpectExec(`INSERT`).WillReturnResult(2)
+
+	var log []string
+	h := &recordingHook{name: "h", log: &log}
+	conn := hookedConn(t, p, h)
+
+	b := &ds.Batch{}
+	b.Queue("INSERT INTO users(name) VALUES($1)", "alice")
+	b.Queue("INSERT INTO users(name) SELECT name FROM invites")
+
+	br := conn.SendBatch(context.Background(), b)
+	if _, err := br.Exec(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(h.events) != 0 {
+		t.Fatal("batch must be reported when closed")
+	}
+	if err := br.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := br.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(h.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(h.events))
+	}
+	ev := h.events[0]
+	if ev.Op != ds.OpBatch || len(ev.Batch) != 2 || ev.RowsAffected != 1 {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
@@ -0,0 +1,128 @@
+package ds
+
+import (
+	"context"
+	"sync"
+)
+
+// LSNReporter is implemented by connections that can report
+// the current write-ahead log position of their server. An empty
+// position means there is nothing to record, as on a read-only replica.
+type LSNReporter interface {
+	CurrentLSN(ctx context.Context) (string, error)
+}
+
+// ConsistencyToken holds the highest LSN written in a context,
+// such as one HTTP request. It is safe for concurrent use.
+type ConsistencyToken struct {
+	mu  sync.Mutex
+	lsn LSN
+	set bool
+}
+
+// LSN returns the recorded LSN, empty if nothing was written.
+func (t *ConsistencyToken) LSN() string {
+	l, ok := t.Position()
+	if !ok {
+		return ""
+	}
+	return l.String()
+}
+
+// Position returns the recorded LSN and whether one was recorded.
+func (t *ConsistencyToken) Position() (LSN, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lsn, t.set
+}
+
+// Observe records lsn unless a later position is already recorded.
+// Empty and malformed values are ignored.
+func (t *ConsistencyToken) Observe(lsn string) {
+	l, err := ParseLSN(lsn)
+	if err != nil {
+		return
+	}
+
+	t.ObservePosition(l)
+}
+
+// ObservePosition records l unless a later position is already recorded.
+func (t *ConsistencyToken) ObservePosition(l LSN) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.set || l > t.lsn {
+		t.lsn, t.set = l, true
+	}
+}
+
+type consistencyContextKey struct{}
+
+var consistencyKey consistencyContextKey
+
+// ContextWithConsistencyToken returns a child context carrying an empty
+// ConsistencyToken. If ctx already carries one, ctx is returned as is.
+//
+// With a token in the context WithTx records the commit LSN and GetSecondary
+// uses it when called with an empty minLSN, so reads observe earlier writes.
+func ContextWithConsistencyToken(ctx context.Context) context.Context {
+	if _, ok := ConsistencyTokenFromContext(ctx); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, consistencyKey, &ConsistencyToken{})
+}
+
+// ConsistencyTokenFromContext returns the ConsistencyToken stored in ctx.
+func ConsistencyTokenFromContext(ctx context.Context) (*ConsistencyToken, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	t, ok := ctx.Value(consistencyKey).(*ConsistencyToken)
+	return t, ok
+}
+
+// CaptureLSN records the current LSN of the server behind conn in the
+// ConsistencyToken of ctx. Call it after writes made outside WithTx.
+// It does nothing if ctx has no token or conn cannot report its LSN.
+// Hooks of conn see the check as an OpCurrentLSN event.
+func CaptureLSN(ctx context.Context, conn Conn) error {
+	t, ok := ConsistencyTokenFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	r, ok := findConn[LSNReporter](conn)
+	if !ok {
+		return nil
+	}
+
+	lsn, err := r.CurrentLSN(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.Observe(lsn)
+	return nil
+}
+
+// findConn finds a T in conn or the connections it wraps.
+func findConn[T any](conn Conn) (T, bool) {
+	for conn != nil {
+		if r, ok := conn.(T); ok {
+			return r, true
+		}
+
+		u, ok := conn.(interface{ Unwrap() Conn })
+		if !ok {
+			break
+		}
+		conn = u.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
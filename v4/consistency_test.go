@@ -0,0 +1,203 @@
+package ds_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+// lsnConn reports a fixed write position on top of a dstest connection.
+type lsnConn struct {
+	ds.Conn
+	lsn   string
+	err   error
+	calls int
+}
+
+func (c *lsnConn) CurrentLSN(context.Context) (string, error) {
+	c.calls++
+	return c.lsn, c.err
+}
+
+func commitUser(t *testing.T, ctx context.Context, conn ds.Conn) {
+	t.Helper()
+
+	err := ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO users(name) VALUES($1)", "alice")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWithTxRecordsCommitLSN(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectExec(`INSERT`)
+	p.ExpectCommit()
+	p.ExpectGetSecondary().WithMinLSN("0/16B3748")
+	p.ExpectGetSecondary().WithMinLSN("0/1")
+
+	ctx := ds.ContextWithConsistencyToken(ds.ContextWithProvider(context.Background(), p))
+
+	pc, id, err := ds.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	// The reporter is found behind hook wrappers.
+	conn := &lsnConn{Conn: pc.Conn(), lsn: "0/16B3748"}
+	hooked := ds.WithHooks(poolConnOf(pc, conn), id, ds.HookFuncs{})
+	commitUser(t, ctx, hooked.Conn())
+
+	token, ok := ds.ConsistencyTokenFromContext(ctx)
+	if !ok || token.LSN() != "0/16B3748" {
+		t.Fatalf("expected recorded LSN, got %q", token.LSN())
+	}
+
+	sc, _, err := ds.GetSecondary(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc.Release()
+
+	// An explicit minLSN takes precedence.
+	sc, _, err = ds.GetSecondary(ctx, "0/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc.Release()
+}
+
+func TestWithTxWithoutConsistencyToken(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectExec(`INSERT`)
+	p.ExpectCommit()
+
+	ctx := context.Background()
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	conn := &lsnConn{Conn: pc.Conn(), lsn: "0/1"}
+	commitUser(t, ctx, conn)
+
+	if conn.calls != 0 {
+		t.Fatalf("expected no LSN capture without a token, got %d calls", conn.calls)
+	}
+}
+
+func TestWithTxOptionsReadOnlySkipsLSN(t *testing.T) {
+	readOnly := ds.TxOptions{AccessMode: ds.AccessReadOnly}
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin().WithOptions(readOnly)
+	p.ExpectCommit()
+
+	ctx := ds.ContextWithConsistencyToken(context.Background())
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	conn := &lsnConn{Conn: pc.Conn(), lsn: "0/1"}
+	err = ds.WithTxOptions(ctx, conn, readOnly, func(context.Context, ds.Tx) error { return nil })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if conn.calls != 0 {
+		t.Fatalf("expected no LSN capture after a read-only transaction, got %d calls", conn.calls)
+	}
+}
+
+func TestWithTxReportsLSNErrorToHooks(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectExec(`INSERT`)
+	p.ExpectCommit()
+
+	ctx := ds.ContextWithConsistencyToken(context.Background())
+
+	pc, id, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	expectedErr := errors.New("not the primary")
+	var events []ds.QueryEvent
+	hooked := ds.WithHooks(poolConnOf(pc, &lsnConn{Conn: pc.Conn(), err: expectedErr}), id, ds.HookFuncs{
+		AfterFunc: func(_ context.Context, ev *ds.QueryEvent) {
+			events = append(events, *ev)
+		},
+	})
+
+	// The transaction is committed, so the failed capture is only reported.
+	commitUser(t, ctx, hooked.Conn())
+
+	last := events[len(events)-1]
+	if last.Op != ds.OpCurrentLSN || !errors.Is(last.Err, expectedErr) {
+		t.Fatalf("expected a failed %s event, got %+v", ds.OpCurrentLSN, last)
+	}
+	if token, _ := ds.ConsistencyTokenFromContext(ctx); token.LSN() != "" {
+		t.Fatalf("expected no recorded LSN, got %q", token.LSN())
+	}
+}
+
+func TestContextWithConsistencyTokenKeepsExisting(t *testing.T) {
+	ctx := ds.ContextWithConsistencyToken(context.Background())
+	token, _ := ds.ConsistencyTokenFromContext(ctx)
+	token.Observe("0/5")
+
+	ctx = ds.ContextWithConsistencyToken(ctx)
+	if got, _ := ds.ConsistencyTokenFromContext(ctx); got != token {
+		t.Fatal("expected the existing token to be kept")
+	}
+}
+
+type poolConn struct {
+	ds.PoolConn
+	conn ds.Conn
+}
+
+func (p poolConn) Conn() ds.Conn { return p.conn }
+
+func poolConnOf(pc ds.PoolConn, conn ds.Conn) ds.PoolConn {
+	return poolConn{PoolConn: pc, conn: conn}
+}
+
+func TestConsistencyTokenKeepsLatestLSN(t *testing.T) {
+	var token ds.ConsistencyToken
+
+	if token.LSN() != "" {
+		t.Fatalf("expected empty token, got %q", token.LSN())
+	}
+
+	token.Observe("0/10")
+	token.Observe("0/5")
+	token.Observe("garbage")
+	if token.LSN() != "0/10" {
+		t.Fatalf("expected 0/10, got %q", token.LSN())
+	}
+
+	token.ObservePosition(1 << 32)
+	if l, ok := token.Position(); !ok || l.String() != "1/0" {
+		t.Fatalf("expected 1/0, got %s", l)
+	}
+}
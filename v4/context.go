@@ -47,11 +47,29 @@ func GetPrimary(ctx context.Context) (PoolConn, ServerID, error) {
 //
 // If minLSN is not empty, the provider should return a replica that has replayed
 // at least that LSN, or fall back to the primary according to provider policy.
+// If minLSN is empty, the LSN recorded in the ConsistencyToken of ctx is used.
 func GetSecondary(ctx context.Context, minLSN string) (PoolConn, ServerID, error) {
 	provider, ok := ProviderFromContext(ctx)
 	if !ok {
 		return nil, "", ErrNoProviderInContext
 	}
 
+	if minLSN == "" {
+		if t, ok := ConsistencyTokenFromContext(ctx); ok {
+			minLSN = t.LSN()
+		}
+	}
+
 	return provider.GetSecondary(ctx, minLSN)
 }
+
+// GetSecondaryWith acquires a connection satisfying opts
+// from the Provider stored in ctx. See GetSecondaryFrom.
+func GetSecondaryWith(ctx context.Context, opts ReadOptions) (PoolConn, ServerID, error) {
+	provider, ok := ProviderFromContext(ctx)
+	if !ok {
+		return nil, "", ErrNoProviderInContext
+	}
+
+	return GetSecondaryFrom(ctx, provider, opts)
+}
@@ -6,21 +6,14 @@ import (
 	"testing"
 
 	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
 )
 
-type contextFakeProvider struct{}
-
-func (f *contextFakeProvider) GetPrimary(ctx context.Context) (ds.PoolConn, ds.ServerID, error) {
-	return nil, "primary", nil
-}
-func (f *contextFakeProvider) GetSecondary(ctx context.Context, _ string) (ds.PoolConn, ds.ServerID, error) {
-	return nil, "secondary", nil
-}
-func (f *contextFakeProvider) Release(ds.PoolConn, ds.ServerID) {}
-func (f *contextFakeProvider) Close() error                     { return nil }
-
 func TestContextAccessors(t *testing.T) {
-	provider := &contextFakeProvider{}
+	provider := dstest.New(t)
+	provider.ExpectGetPrimary()
+	provider.ExpectGetSecondary().WithMinLSN("0/1")
+
 	ctx := ds.ContextWithProvider(context.Background(), provider)
 
 	gotProvider, ok := ds.ProviderFromContext(ctx)
@@ -31,19 +24,23 @@ func TestContextAccessors(t *testing.T) {
 		t.Fatal("unexpected provider from context")
 	}
 
-	_, primaryID, err := ds.GetPrimary(ctx)
+	primary, primaryID, err := ds.GetPrimary(ctx)
 	if err != nil {
 		t.Fatalf("unexpected primary error: %v", err)
 	}
-	if primaryID != "primary" {
+	defer primary.Release()
+
+	if primaryID != dstest.PrimaryID {
 		t.Fatalf("expected primary, got %s", primaryID)
 	}
 
-	_, secondaryID, err := ds.GetSecondary(ctx, "0/1")
+	secondary, secondaryID, err := ds.GetSecondary(ctx, "0/1")
 	if err != nil {
 		t.Fatalf("unexpected secondary error: %v", err)
 	}
-	if secondaryID != "secondary" {
+	defer secondary.Release()
+
+	if secondaryID != dstest.SecondaryID {
 		t.Fatalf("expected secondary, got %s", secondaryID)
 	}
 }
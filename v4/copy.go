@@ -0,0 +1,284 @@
+package ds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrCopyNotSupported = errors.New("ds: COPY is not supported by the connection")
+
+// CopySource yields the rows written by CopyFrom.
+// Its method set matches pgx.CopyFromSource.
+type CopySource interface {
+	Next() bool
+	Values() ([]any, error)
+	Err() error
+}
+
+// CopyFormat is the data format of CopyTo.
+type CopyFormat int
+
+const (
+	CopyText CopyFormat = iota
+	CopyCSV
+	CopyBinary
+)
+
+func (f CopyFormat) String() string {
+	switch f {
+	case CopyText:
+		return "text"
+	case CopyCSV:
+		return "csv"
+	case CopyBinary:
+		return "binary"
+	}
+	return "unknown"
+}
+
+// CopyOptions configures CopyTo.
+type CopyOptions struct {
+	Format CopyFormat
+	// Header writes a header line with the column names.
+	Header bool
+	// Delimiter separates columns in text and CSV output.
+	// Zero uses the format default.
+	Delimiter rune
+}
+
+// Copier is implemented by connections and transactions supporting
+// bulk transfer with COPY. Use the CopyFrom and CopyTo functions,
+// which fall back for connections without it.
+type Copier interface {
+	// CopyFrom writes the rows of src to columns of table and returns
+	// the number of rows written. table may be schema-qualified with
+	// a dot; names are quoted.
+	CopyFrom(ctx context.Context, table string, columns []string, src CopySource) (int64, error)
+	// CopyTo writes the result of query to w in the format of opts and
+	// returns the number of rows written. query takes no arguments.
+	CopyTo(ctx context.Context, query string, w io.Writer, opts CopyOptions) (int64, error)
+}
+
+// InsertOptions configures the statements of InsertRows.
+// Zero fields take defaults.
+type InsertOptions struct {
+	// Placeholder returns the placeholder of parameter n, counted
+	// from 1. Default DollarPlaceholder.
+	Placeholder func(n int) string
+	// MaxParams bounds the parameters of one statement. Default 999,
+	// the limit of SQLite before 3.32 and the lowest among common
+	// databases.
+	MaxParams int
+	// QuoteIdentifier quotes one dot-separated part of the table and
+	// column names. Default DoubleQuoteIdentifier.
+	QuoteIdentifier func(name string) string
+}
+
+const defaultInsertMaxParams = 999
+
+func (o InsertOptions) withDefaults() InsertOptions {
+	if o.Placeholder == nil {
+		o.Placeholder = DollarPlaceholder
+	}
+	if o.MaxParams <= 0 {
+		o.MaxParams = defaultInsertMaxParams
+	}
+	if o.QuoteIdentifier == nil {
+		o.QuoteIdentifier = DoubleQuoteIdentifier
+	}
+	return o
+}
+
+// InsertDialect is implemented by connections and transactions whose
+// database needs other InsertOptions than the defaults, such as
+// drivers using ? placeholders or backtick-quoted names.
+type InsertDialect interface {
+	InsertOptions() InsertOptions
+}
+
+// DollarPlaceholder returns $n, the placeholder style of PostgreSQL
+// and SQLite.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// QuestionPlaceholder returns ?, the placeholder style of MySQL
+// and SQLite.
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DoubleQuoteIdentifier returns "name", the standard SQL quoting used by
+// PostgreSQL and SQLite.
+func DoubleQuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// BacktickIdentifier returns `name`, the quoting of MySQL.
+func BacktickIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// BracketIdentifier returns [name], the quoting of SQL Server.
+func BracketIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// insertOptionsOf returns the InsertOptions of q with defaults applied.
+func insertOptionsOf(q Querier) InsertOptions {
+	if d, ok := q.(InsertDialect); ok {
+		return d.InsertOptions().withDefaults()
+	}
+	return InsertOptions{}.withDefaults()
+}
+
+// CopyFrom writes the rows of src to table with q's Copier, or with
+// InsertRows if q has none.
+func CopyFrom(ctx context.Context, q Querier, table string, columns []string, src CopySource) (int64, error) {
+	if c, ok := q.(Copier); ok {
+		return c.CopyFrom(ctx, table, columns, src)
+	}
+	return InsertRows(ctx, q, table, columns, src)
+}
+
+// CopyTo writes the result of query to w with q's Copier.
+// It returns ErrCopyNotSupported if q has none.
+func CopyTo(ctx context.Context, q Querier, query string, w io.Writer, opts CopyOptions) (int64, error) {
+	if c, ok := q.(Copier); ok {
+		return c.CopyTo(ctx, query, w, opts)
+	}
+	return 0, ErrCopyNotSupported
+}
+
+// InsertRows writes the rows of src to table with multi-row INSERT
+// statements. It is the CopyFrom fallback for connections without COPY.
+// Placeholders, name quoting and the parameters per statement follow the
+// InsertOptions of q if it is an InsertDialect. Rows are split over several statements,
+// so outside a transaction a failure leaves earlier rows written.
+func InsertRows(ctx context.Context, q Querier, table string, columns []string, src CopySource) (int64, error) {
+	if len(columns) == 0 {
+		return 0, errors.New("ds: InsertRows requires columns")
+	}
+	opts := insertOptionsOf(q)
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col, opts.QuoteIdentifier)
+	}
+	prefix := "INSERT INTO " + quoteIdentifier(table, opts.QuoteIdentifier) + " (" + strings.Join(quoted, ", ") + ") VALUES "
+	perStmt := max(1, opts.MaxParams/len(columns))
+
+	var (
+		total int64
+		sql   strings.Builder
+		args  = make([]any, 0, perStmt*len(columns))
+		rows  int
+	)
+
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		res, err := q.Exec(ctx, sql.String(), args...)
+		if err != nil {
+			return err
+		}
+		total += res.RowsAffected()
+		sql.Reset()
+		args, rows = args[:0], 0
+		return nil
+	}
+
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return total, err
+		}
+		if len(values) != len(columns) {
+			return total, fmt.Errorf("ds: InsertRows got %d values for %d columns", len(values), len(columns))
+		}
+
+		if rows == 0 {
+			sql.WriteString(prefix)
+		} else {
+			sql.WriteString(", ")
+		}
+		sql.WriteByte('(')
+		for i, v := range values {
+			if i > 0 {
+				sql.WriteString(", ")
+			}
+			args = append(args, v)
+			sql.WriteString(opts.Placeholder(len(args)))
+		}
+		sql.WriteByte(')')
+
+		if rows++; rows == perStmt {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := src.Err(); err != nil {
+		return total, err
+	}
+
+	return total, flush()
+}
+
+// quoteIdentifier quotes each dot-separated part of name with quote.
+func quoteIdentifier(name string, quote func(string) string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// CopyFromRows returns a CopySource over rows.
+func CopyFromRows(rows [][]any) CopySource {
+	return CopyFromFunc(len(rows), func(i int) ([]any, error) {
+		return rows[i], nil
+	})
+}
+
+// CopyFromFunc returns a CopySource of n rows built by next,
+// which is called with the row indexes in order:
+//
+//	src := ds.CopyFromFunc(len(users), func(i int) ([]any, error) {
+//		return []any{users[i].ID, users[i].Name}, nil
+//	})
+func CopyFromFunc(n int, next func(i int) ([]any, error)) CopySource {
+	return &funcSource{n: n, next: next, i: -1}
+}
+
+type funcSource struct {
+	n    int
+	next func(i int) ([]any, error)
+	i    int
+	err  error
+}
+
+func (s *funcSource) Next() bool {
+	if s.err != nil || s.i+1 >= s.n {
+		return false
+	}
+	s.i++
+	return true
+}
+
+func (s *funcSource) Values() ([]any, error) {
+	values, err := s.next(s.i)
+	if err != nil {
+		s.err = err
+	}
+	return values, err
+}
+
+func (s *funcSource) Err() error {
+	return s.err
+}
@@ -0,0 +1,147 @@
+package ds_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+func TestCopyFromFallsBackToInsert(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`^INSERT INTO "public"\."users" \("id", "name"\) VALUES \(\$1, \$2\), \(\$3, \$4\)$`).
+		WithArgs(1, "alice", 2, "bob").
+		WillReturnResult(2)
+
+	var log []string
+	h := &recordingHook{name: "h", log: &log}
+	conn := hookedConn(t, p, h)
+
+	n, err := ds.CopyFrom(context.Background(), conn, "public.users", []string{"id", "name"}, ds.CopyFromRows([][]any{
+		{1, "alice"},
+		{2, "bob"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+
+	ev := h.events[0]
+	if ev.Op != ds.OpCopyFrom || ev.RowsAffected != 2 || ev.SQL != "COPY public.users (id, name) FROM STDIN" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+func TestInsertRowsSplitsStatements(t *testing.T) {
+	columns := make([]string, 600)
+	values := make([]any, len(columns))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("c%d", i)
+		values[i] = i
+	}
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`^INSERT INTO "wide"`).WillReturnResult(1)
+	p.ExpectExec(`^INSERT INTO "wide"`).WillReturnResult(1)
+
+	n, err := ds.InsertRows(context.Background(), primaryConn(t, p), "wide", columns, ds.CopyFromRows([][]any{values, values}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+}
+
+// dialectConn sets the InsertOptions of a connection.
+type dialectConn struct {
+	ds.Conn
+	opts ds.InsertOptions
+}
+
+func (c dialectConn) InsertOptions() ds.InsertOptions { return c.opts }
+
+type dialectPoolConn struct {
+	ds.PoolConn
+	opts ds.InsertOptions
+}
+
+func (pc dialectPoolConn) Conn() ds.Conn {
+	return dialectConn{Conn: pc.PoolConn.Conn(), opts: pc.opts}
+}
+
+func TestInsertRowsUsesDialect(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`^INSERT INTO "users" \("id", "name"\) VALUES \(\?, \?\), \(\?, \?\)$`).
+		WithArgs(1, "alice", 2, "bob").
+		WillReturnResult(2)
+	p.ExpectExec(`^INSERT INTO "users" \("id", "name"\) VALUES \(\?, \?\)$`).
+		WithArgs(3, "carol").
+		WillReturnResult(1)
+
+	pc, id, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Hooks pass the options of the wrapped connection through.
+	hpc := ds.WithHooks(dialectPoolConn{
+		PoolConn: pc,
+		opts:     ds.InsertOptions{Placeholder: ds.QuestionPlaceholder, MaxParams: 5},
+	}, id, &recordingHook{name: "h", log: new([]string)})
+	defer hpc.Release()
+
+	n, err := ds.CopyFrom(context.Background(), hpc.Conn(), "users", []string{"id", "name"}, ds.CopyFromRows([][]any{
+		{1, "alice"},
+		{2, "bob"},
+		{3, "carol"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+}
+
+func TestInsertRowsSourceErrors(t *testing.T) {
+	expectedErr := errors.New("bad row")
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	conn := primaryConn(t, p)
+
+	src := ds.CopyFromFunc(2, func(i int) ([]any, error) {
+		return nil, expectedErr
+	})
+	if _, err := ds.InsertRows(context.Background(), conn, "users", []string{"name"}, src); !errors.Is(err, expectedErr) {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+	if src.Next() {
+		t.Fatal("expected the source to stop after an error")
+	}
+
+	_, err := ds.InsertRows(context.Background(), conn, "users", []string{"id", "name"}, ds.CopyFromRows([][]any{{1}}))
+	if err == nil {
+		t.Fatal("expected error for a short row")
+	}
+}
+
+func TestCopyToNotSupported(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+
+	var buf bytes.Buffer
+	_, err := ds.CopyTo(context.Background(), primaryConn(t, p), "SELECT 1", &buf, ds.CopyOptions{})
+	if !errors.Is(err, ds.ErrCopyNotSupported) {
+		t.Fatalf("expected ErrCopyNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// Package dshttp provides HTTP middleware that carries a ds consistency
+// token between requests, giving clients read-your-writes across requests.
+package dshttp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/dronm/ds/v4"
+)
+
+const (
+	DefaultCookieName = "ds_lsn"
+	DefaultHeaderName = "X-Ds-Lsn"
+)
+
+// Options configures Middleware. Zero fields take default values.
+type Options struct {
+	// Provider, if set, is attached to the request context
+	// with ds.ContextWithProvider.
+	Provider ds.Provider
+
+	// Secret keys the HMAC signing the tokens sent to clients, so that
+	// a client can only send back a position the server issued. Without
+	// it, any client could send a far-future LSN and make every read of
+	// its requests wait for replicas and fall back to the primary.
+	// Instances sharing clients must share the secret. If empty, a random
+	// secret is generated and tokens are only accepted by the Middleware
+	// that issued them.
+	Secret []byte
+
+	// HeaderName is the request and response header carrying the token,
+	// DefaultHeaderName by default. The header takes precedence over
+	// the cookie when a request carries both.
+	HeaderName string
+	// DisableHeader stops reading and writing the header.
+	DisableHeader bool
+
+	// CookieName is the cookie carrying the token, DefaultCookieName by default.
+	CookieName string
+	// DisableCookie stops reading and writing the cookie.
+	DisableCookie bool
+	// CookiePath is the cookie path, "/" by default.
+	CookiePath string
+	// CookieMaxAge is the cookie lifetime in seconds, session cookie if zero.
+	CookieMaxAge int
+	// CookieSecure sets the Secure attribute of the cookie.
+	CookieSecure bool
+	// CookieSameSite sets the SameSite attribute, Lax by default.
+	CookieSameSite http.SameSite
+}
+
+func (o Options) withDefaults() Options {
+	if o.HeaderName == "" {
+		o.HeaderName = DefaultHeaderName
+	}
+	if o.CookieName == "" {
+		o.CookieName = DefaultCookieName
+	}
+	if o.CookiePath == "" {
+		o.CookiePath = "/"
+	}
+	if o.CookieSameSite == 0 {
+		o.CookieSameSite = http.SameSiteLaxMode
+	}
+	if len(o.Secret) == 0 {
+		o.Secret = make([]byte, 32)
+		_, _ = rand.Read(o.Secret)
+	}
+	return o
+}
+
+// Middleware places a ds.ConsistencyToken in the request context, seeded
+// with the LSN sent by the client. When the handler records a newer LSN,
+// for example by committing with ds.WithTx, it is written back to the
+// response before the status line. Tokens are written as the LSN and its
+// signature separated by a dot; malformed or unsigned client tokens are
+// ignored.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	opts = opts.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if opts.Provider != nil {
+				ctx = ds.ContextWithProvider(ctx, opts.Provider)
+			}
+			ctx = ds.ContextWithConsistencyToken(ctx)
+
+			token, _ := ds.ConsistencyTokenFromContext(ctx)
+			sent, ok := opts.readToken(r)
+			if ok {
+				token.ObservePosition(sent)
+			}
+
+			tw := &tokenWriter{ResponseWriter: w, opts: &opts, token: token, sent: sent}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			tw.writeToken()
+		})
+	}
+}
+
+func (o *Options) readToken(r *http.Request) (ds.LSN, bool) {
+	var v string
+	if !o.DisableHeader {
+		v = r.Header.Get(o.HeaderName)
+	}
+	if v == "" && !o.DisableCookie {
+		if c, err := r.Cookie(o.CookieName); err == nil {
+			v = c.Value
+		}
+	}
+
+	return o.verify(v)
+}
+
+// sign returns lsn with its signature appended.
+func (o *Options) sign(lsn ds.LSN) string {
+	v := lsn.String()
+	return v + "." + o.mac(v)
+}
+
+// verify returns the LSN of a token produced by sign.
+func (o *Options) verify(token string) (ds.LSN, bool) {
+	v, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(o.mac(v))) {
+		return 0, false
+	}
+
+	lsn, err := ds.ParseLSN(v)
+	return lsn, err == nil
+}
+
+func (o *Options) mac(v string) string {
+	h := hmac.New(sha256.New, o.Secret)
+	h.Write([]byte(v))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// tokenWriter writes the token to the response headers
+// right before they are sent.
+type tokenWriter struct {
+	http.ResponseWriter
+	opts  *Options
+	token *ds.ConsistencyToken
+	sent  ds.LSN
+
+	written bool
+}
+
+func (w *tokenWriter) writeToken() {
+	if w.written {
+		return
+	}
+	w.written = true
+
+	pos, ok := w.token.Position()
+	if !ok || pos == w.sent {
+		return
+	}
+	lsn := w.opts.sign(pos)
+
+	if !w.opts.DisableHeader {
+		w.Header().Set(w.opts.HeaderName, lsn)
+	}
+	if !w.opts.DisableCookie {
+		http.SetCookie(w.ResponseWriter, &http.Cookie{
+			Name:     w.opts.CookieName,
+			Value:    lsn,
+			Path:     w.opts.CookiePath,
+			MaxAge:   w.opts.CookieMaxAge,
+			Secure:   w.opts.CookieSecure,
+			HttpOnly: true,
+			SameSite: w.opts.CookieSameSite,
+		})
+	}
+}
+
+func (w *tokenWriter) WriteHeader(code int) {
+	w.writeToken()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *tokenWriter) Write(b []byte) (int, error) {
+	w.writeToken()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *tokenWriter) Flush() {
+	w.writeToken()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *tokenWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,189 @@
+package dshttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+var testSecret = []byte("test secret")
+
+// signed returns the token the middleware writes for lsn.
+func signed(t *testing.T, lsn string) string {
+	t.Helper()
+
+	v, err := ds.ParseLSN(lsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Secret: testSecret}
+	return opts.sign(v)
+}
+
+func serve(t *testing.T, opts Options, h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	if opts.Secret == nil {
+		opts.Secret = testSecret
+	}
+
+	rec := httptest.NewRecorder()
+	Middleware(opts)(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func observe(lsn string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := ds.ConsistencyTokenFromContext(r.Context())
+		if !ok {
+			http.Error(w, "no token", http.StatusInternalServerError)
+			return
+		}
+		token.Observe(lsn)
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+func TestMiddlewareWritesNewLSN(t *testing.T) {
+	rec := serve(t, Options{}, observe("0/16B3748"), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	want := signed(t, "0/16B3748")
+	if got := rec.Header().Get(DefaultHeaderName); got != want {
+		t.Fatalf("expected LSN header, got %q", got)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCookieName || cookies[0].Value != want {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+	if !cookies[0].HttpOnly || cookies[0].Path != "/" {
+		t.Fatalf("unexpected cookie attributes: %+v", cookies[0])
+	}
+}
+
+func TestMiddlewareReadsClientToken(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetSecondary().WithMinLSN("0/AB")
+
+	read := func(w http.ResponseWriter, r *http.Request) {
+		pc, _, err := ds.GetSecondary(r.Context(), "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pc.Release()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: signed(t, "0/AB")})
+
+	rec := serve(t, Options{Provider: p}, read, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+
+	// An unchanged token is not written back.
+	if got := rec.Header().Get(DefaultHeaderName); got != "" {
+		t.Fatalf("expected no LSN header, got %q", got)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("expected no cookie")
+	}
+}
+
+func TestMiddlewareHeaderTakesPrecedence(t *testing.T) {
+	var got string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		token, _ := ds.ConsistencyTokenFromContext(r.Context())
+		got = token.LSN()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultHeaderName, signed(t, "0/2"))
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: signed(t, "0/1")})
+
+	serve(t, Options{}, h, req)
+	if got != "0/2" {
+		t.Fatalf("expected header token, got %q", got)
+	}
+}
+
+func TestMiddlewareIgnoresMalformedToken(t *testing.T) {
+	forged := Options{Secret: []byte("other secret")}
+	for _, v := range []string{
+		"garbage", "0/", "/1", "0/1'; DROP TABLE users", "100000000/0",
+		"0/1",                        // unsigned
+		"FFFFFFFF/FFFFFFFF",          // unsigned far-future position
+		forged.sign(ds.LSN(1)),       // signed with another secret
+		signed(t, "0/1") + "x",       // tampered signature
+		"0/2" + signed(t, "0/1")[3:], // signature of another LSN
+	} {
+		var got string
+		h := func(w http.ResponseWriter, r *http.Request) {
+			token, _ := ds.ConsistencyTokenFromContext(r.Context())
+			got = token.LSN()
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultHeaderName, v)
+
+		serve(t, Options{}, h, req)
+		if got != "" {
+			t.Fatalf("expected %q to be ignored, got %q", v, got)
+		}
+	}
+}
+
+func TestMiddlewareWritesTokenWithoutBody(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		token, _ := ds.ConsistencyTokenFromContext(r.Context())
+		token.Observe("0/3")
+	}
+
+	rec := serve(t, Options{DisableCookie: true}, h, httptest.NewRequest(http.MethodPost, "/", nil))
+	if got := rec.Header().Get(DefaultHeaderName); got != signed(t, "0/3") {
+		t.Fatalf("expected LSN header, got %q", got)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("expected cookie to be disabled")
+	}
+}
+
+func TestMiddlewareKeepsOuterToken(t *testing.T) {
+	outer := ds.ContextWithConsistencyToken(context.Background())
+	token, _ := ds.ConsistencyTokenFromContext(outer)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(outer)
+	serve(t, Options{}, observe("0/4"), req)
+
+	if token.LSN() != "0/4" {
+		t.Fatalf("expected outer token to be updated, got %q", token.LSN())
+	}
+}
+
+func TestMiddlewareGeneratesSecret(t *testing.T) {
+	// Without a Secret, tokens of another Middleware are not accepted.
+	first := httptest.NewRecorder()
+	Middleware(Options{})(observe("0/5")).ServeHTTP(first, httptest.NewRequest(http.MethodPost, "/", nil))
+	token := first.Header().Get(DefaultHeaderName)
+	if token == "" {
+		t.Fatal("expected LSN header")
+	}
+
+	var got string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		tok, _ := ds.ConsistencyTokenFromContext(r.Context())
+		got = tok.LSN()
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultHeaderName, token)
+	Middleware(Options{})(http.HandlerFunc(h)).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "" {
+		t.Fatalf("expected token of another secret to be ignored, got %q", got)
+	}
+}
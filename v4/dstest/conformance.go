@@ -0,0 +1,773 @@
+package dstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+// Factory returns a provider connected to an empty, writable database.
+//
+// The provider must not route secondaries to a separate server: the
+// conformance suite writes on the primary and expects GetSecondary to
+// fall back to it. The suite closes the provider when the test ends.
+type Factory func(t *testing.T) ds.Provider
+
+var conformanceSeq atomic.Int64
+
+// RunConformance checks that the providers returned by factory honour
+// the contracts of ds.Storage, ds.Conn, ds.Tx and ds.PreparedStatement
+// the same way pgds does.
+//
+// Queries use $N placeholders and portable SQL, so the suite runs
+// against PostgreSQL and SQLite alike.
+func RunConformance(t *testing.T, factory Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, c *conformance)
+	}{
+		{"GetPrimary", testGetPrimary},
+		{"GetSecondaryFallsBackToPrimary", testGetSecondaryFallback},
+		{"ReleaseIsIdempotent", testReleaseIsIdempotent},
+		{"CancelledContext", testCancelledContext},
+		{"ExecRowsAffected", testExecRowsAffected},
+		{"QueryRows", testQueryRows},
+		{"QueryRowErrNoRows", testQueryRowErrNoRows},
+		{"CollectRows", testCollectRows},
+		{"TxCommit", testTxCommit},
+		{"TxRollback", testTxRollback},
+		{"TxDone", testTxDone},
+		{"TxCommitRollback", testTxCommitRollback},
+		{"WithTx", testWithTx},
+		{"NestedTx", testNestedTx},
+		{"Batch", testBatch},
+		{"BatchInTx", testBatchInTx},
+		{"CopyFrom", testCopyFrom},
+		{"PreparedStatement", testPreparedStatement},
+		{"PreparedStatementScopedToConn", testPreparedStatementScopedToConn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newConformance(t, factory))
+		})
+	}
+}
+
+type conformance struct {
+	p     ds.Provider
+	table string
+}
+
+func newConformance(t *testing.T, factory Factory) *conformance {
+	t.Helper()
+
+	p := factory(t)
+	if p == nil {
+		t.Fatal("factory returned nil provider")
+	}
+
+	c := &conformance{
+		p:     p,
+		table: fmt.Sprintf("ds_conformance_%d_%d", time.Now().Unix(), conformanceSeq.Add(1)),
+	}
+
+	c.exec(t, fmt.Sprintf(
+		`CREATE TABLE %s (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		c.table,
+	))
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if pc, _, err := p.GetPrimary(ctx); err == nil {
+			_, _ = pc.Conn().Exec(ctx, "DROP TABLE "+c.table)
+			pc.Release()
+		}
+		_ = p.Close()
+	})
+
+	return c
+}
+
+func (c *conformance) primary(t *testing.T) ds.Conn {
+	t.Helper()
+
+	pc, id, err := c.p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	t.Cleanup(func() { c.p.Release(pc, id) })
+
+	return pc.Conn()
+}
+
+func (c *conformance) exec(t *testing.T, sql string, args ...any) ds.ExecResult {
+	t.Helper()
+
+	ctx := context.Background()
+
+	pc, id, err := c.p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer c.p.Release(pc, id)
+
+	res, err := pc.Conn().Exec(ctx, sql, args...)
+	if err != nil {
+		t.Fatalf("Exec(%q) failed: %v", sql, err)
+	}
+	return res
+}
+
+func (c *conformance) count(t *testing.T) int64 {
+	t.Helper()
+
+	ctx := context.Background()
+
+	pc, id, err := c.p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer c.p.Release(pc, id)
+
+	var n int64
+	if err := pc.Conn().QueryRow(ctx, "SELECT count(*) FROM "+c.table).Scan(&n); err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	return n
+}
+
+func (c *conformance) insertSQL() string {
+	return "INSERT INTO " + c.table + " (id, name) VALUES ($1, $2)"
+}
+
+func testGetPrimary(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	pc, id, err := c.p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer c.p.Release(pc, id)
+
+	if id == "" {
+		t.Fatal("GetPrimary() returned empty ServerID")
+	}
+
+	var n int64
+	if err := pc.Conn().QueryRow(ctx, "SELECT 1").Scan(&n); err != nil {
+		t.Fatalf("QueryRow() failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+}
+
+func testGetSecondaryFallback(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	primary, primaryID, err := c.p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	c.p.Release(primary, primaryID)
+
+	for _, minLSN := range []string{"", "0/0"} {
+		pc, id, err := c.p.GetSecondary(ctx, minLSN)
+		if err != nil {
+			t.Fatalf("GetSecondary(%q) failed: %v", minLSN, err)
+		}
+
+		var n int64
+		err = pc.Conn().QueryRow(ctx, "SELECT count(*) FROM "+c.table).Scan(&n)
+		c.p.Release(pc, id)
+
+		if err != nil {
+			t.Fatalf("GetSecondary(%q) connection is not usable: %v", minLSN, err)
+		}
+		if id != primaryID {
+			t.Fatalf("GetSecondary(%q) returned %s, expected fallback to %s", minLSN, id, primaryID)
+		}
+	}
+}
+
+func testReleaseIsIdempotent(t *testing.T, c *conformance) {
+	pc, id, err := c.p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+
+	pc.Release()
+	pc.Release()
+	c.p.Release(pc, id)
+	c.p.Release(nil, id)
+}
+
+func testCancelledContext(t *testing.T, c *conformance) {
+	conn := c.primary(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := c.p.GetPrimary(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetPrimary() expected context.Canceled, got %v", err)
+	}
+	if _, _, err := c.p.GetSecondary(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetSecondary() expected context.Canceled, got %v", err)
+	}
+	if _, err := conn.Exec(ctx, c.insertSQL(), 1, "alice"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Exec() expected context.Canceled, got %v", err)
+	}
+	if _, err := conn.Query(ctx, "SELECT id FROM "+c.table); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Query() expected context.Canceled, got %v", err)
+	}
+	if _, err := conn.Begin(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Begin() expected context.Canceled, got %v", err)
+	}
+
+	// The connection stays usable with a live context.
+	if n := c.count(t); n != 0 {
+		t.Fatalf("expected empty table, got %d rows", n)
+	}
+}
+
+func testExecRowsAffected(t *testing.T, c *conformance) {
+	c.exec(t, c.insertSQL(), 1, "alice")
+	c.exec(t, c.insertSQL(), 2, "bob")
+
+	res := c.exec(t, "UPDATE "+c.table+" SET name = $1", "carol")
+	if res.RowsAffected() != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", res.RowsAffected())
+	}
+
+	res = c.exec(t, "DELETE FROM "+c.table+" WHERE id = $1", 3)
+	if res.RowsAffected() != 0 {
+		t.Fatalf("expected 0 rows affected, got %d", res.RowsAffected())
+	}
+}
+
+func testQueryRows(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	c.exec(t, c.insertSQL(), 1, "alice")
+	c.exec(t, c.insertSQL(), 2, "bob")
+
+	rows, err := c.primary(t).Query(ctx, "SELECT id, name FROM "+c.table+" WHERE id >= $1 ORDER BY id", 1)
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("Scan() failed: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err() failed: %v", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Fatalf("unexpected rows: %v", names)
+	}
+}
+
+func testCollectRows(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	c.exec(t, c.insertSQL(), 1, "alice")
+	c.exec(t, c.insertSQL(), 2, "bob")
+
+	type item struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	rows, err := c.primary(t).Query(ctx, "SELECT id, name FROM "+c.table+" ORDER BY id")
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Columns() failed: %v", err)
+	}
+	if len(columns) != 2 || columns[0] != "id" || columns[1] != "name" {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+
+	items, err := ds.CollectRows[item](rows)
+	if err != nil {
+		t.Fatalf("CollectRows() failed: %v", err)
+	}
+	if len(items) != 2 || items[0] != (item{1, "alice"}) || items[1] != (item{2, "bob"}) {
+		t.Fatalf("unexpected rows: %v", items)
+	}
+
+	rows, err = c.primary(t).Query(ctx, "SELECT id FROM "+c.table+" ORDER BY id")
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+	if _, err := ds.CollectOne[item](rows); !errors.Is(err, ds.ErrColumnMismatch) {
+		t.Fatalf("expected ErrColumnMismatch, got %v", err)
+	}
+}
+
+func testQueryRowErrNoRows(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	conn := c.primary(t)
+	sql := "SELECT name FROM " + c.table + " WHERE id = $1"
+
+	var name string
+	if err := conn.QueryRow(ctx, sql, 1).Scan(&name); !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("Conn.QueryRow() expected ds.ErrNoRows, got %v", err)
+	}
+
+	err := ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		return tx.QueryRow(ctx, sql, 1).Scan(&name)
+	})
+	if !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("Tx.QueryRow() expected ds.ErrNoRows, got %v", err)
+	}
+}
+
+func testTxCommit(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	tx, err := c.primary(t).Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin() failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, c.insertSQL(), 1, "alice"); err != nil {
+		t.Fatalf("Exec() failed: %v", err)
+	}
+
+	var name string
+	if err := tx.QueryRow(ctx, "SELECT name FROM "+c.table+" WHERE id = $1", 1).Scan(&name); err != nil {
+		t.Fatalf("QueryRow() inside transaction failed: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+
+	if n := c.count(t); n != 1 {
+		t.Fatalf("expected 1 committed row, got %d", n)
+	}
+}
+
+func testTxRollback(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	tx, err := c.primary(t).Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin() failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, c.insertSQL(), 1, "alice"); err != nil {
+		t.Fatalf("Exec() failed: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	if n := c.count(t); n != 0 {
+		t.Fatalf("expected no rows after rollback, got %d", n)
+	}
+}
+
+func testTxDone(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	tx, err := c.primary(t).Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin() failed: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+
+	if err := tx.Commit(ctx); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("second Commit() expected ds.ErrTxDone, got %v", err)
+	}
+	if err := tx.Rollback(ctx); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("Rollback() after Commit() expected ds.ErrTxDone, got %v", err)
+	}
+	if _, err := tx.Exec(ctx, c.insertSQL(), 1, "alice"); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("Exec() after Commit() expected ds.ErrTxDone, got %v", err)
+	}
+}
+
+func testTxCommitRollback(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	c.exec(t, c.insertSQL(), 1, "alice")
+
+	tx, err := c.primary(t).Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin() failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, c.insertSQL(), 2, "bob"); err != nil {
+		t.Fatalf("Exec() failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, c.insertSQL(), 1, "duplicate"); err == nil {
+		t.Fatal("duplicate key insert expected error")
+	}
+
+	// Providers that abort the transaction on error must report the
+	// forced rollback as ds.ErrTxCommitRollback, others commit.
+	err = tx.Commit(ctx)
+	switch {
+	case err == nil:
+		if n := c.count(t); n != 2 {
+			t.Fatalf("expected 2 rows after commit, got %d", n)
+		}
+	case errors.Is(err, ds.ErrTxCommitRollback):
+		if n := c.count(t); n != 1 {
+			t.Fatalf("expected 1 row after forced rollback, got %d", n)
+		}
+	default:
+		t.Fatalf("Commit() expected nil or ds.ErrTxCommitRollback, got %v", err)
+	}
+}
+
+func testWithTx(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	conn := c.primary(t)
+	expectedErr := errors.New("callback failed")
+
+	err := ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		if _, err := tx.Exec(ctx, c.insertSQL(), 1, "alice"); err != nil {
+			return err
+		}
+		return expectedErr
+	})
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+
+	err = ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		_, err := tx.Exec(ctx, c.insertSQL(), 2, "bob")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx() failed: %v", err)
+	}
+
+	if n := c.count(t); n != 1 {
+		t.Fatalf("expected 1 committed row, got %d", n)
+	}
+}
+
+func testNestedTx(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	conn := c.primary(t)
+	expectedErr := errors.New("nested callback failed")
+
+	err := ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		if _, err := tx.Exec(ctx, c.insertSQL(), 1, "alice"); err != nil {
+			return err
+		}
+
+		// A failing nested transaction is rolled back to its savepoint.
+		err := ds.WithTx(ctx, tx, func(ctx context.Context, tx ds.Tx) error {
+			if _, err := tx.Exec(ctx, c.insertSQL(), 2, "bob"); err != nil {
+				return err
+			}
+			return expectedErr
+		})
+		if !errors.Is(err, expectedErr) {
+			t.Fatalf("expected nested callback error, got %v", err)
+		}
+
+		// A failed statement inside a savepoint does not abort the outer transaction.
+		err = ds.WithTx(ctx, tx, func(ctx context.Context, tx ds.Tx) error {
+			_, err := tx.Exec(ctx, c.insertSQL(), 1, "duplicate")
+			return err
+		})
+		if err == nil {
+			t.Fatal("duplicate key insert expected error")
+		}
+
+		return ds.WithTx(ctx, tx, func(ctx context.Context, tx ds.Tx) error {
+			if _, err := tx.Exec(ctx, c.insertSQL(), 3, "carol"); err != nil {
+				return err
+			}
+
+			// Nesting goes deeper than one level.
+			return ds.WithTx(ctx, tx, func(ctx context.Context, tx ds.Tx) error {
+				_, err := tx.Exec(ctx, c.insertSQL(), 4, "dave")
+				return err
+			})
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() failed: %v", err)
+	}
+
+	if n := c.count(t); n != 3 {
+		t.Fatalf("expected 3 committed rows, got %d", n)
+	}
+
+	// Nested commits are undone by an outer rollback.
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin() failed: %v", err)
+	}
+	nested, err := tx.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Tx.Begin() failed: %v", err)
+	}
+	if _, err := nested.Exec(ctx, c.insertSQL(), 5, "erin"); err != nil {
+		t.Fatalf("Exec() failed: %v", err)
+	}
+	if err := nested.Commit(ctx); err != nil {
+		t.Fatalf("nested Commit() failed: %v", err)
+	}
+	if err := nested.Commit(ctx); err == nil {
+		t.Fatal("second nested Commit() expected error")
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	if n := c.count(t); n != 3 {
+		t.Fatalf("expected 3 rows after outer rollback, got %d", n)
+	}
+}
+
+func testBatch(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	b := &ds.Batch{}
+	b.Queue(c.insertSQL(), 1, "alice")
+	b.Queue(c.insertSQL(), 2, "bob")
+	b.Queue("SELECT name FROM "+c.table+" WHERE id = $1", 2)
+	b.Queue("SELECT name FROM " + c.table + " ORDER BY id")
+	b.Queue("UPDATE " + c.table + " SET name = name")
+
+	br := c.primary(t).SendBatch(ctx, b)
+
+	for i := range 2 {
+		res, err := br.Exec()
+		if err != nil {
+			t.Fatalf("Exec() of statement %d failed: %v", i, err)
+		}
+		if n := res.RowsAffected(); n != 1 {
+			t.Fatalf("statement %d: expected 1 row affected, got %d", i, n)
+		}
+	}
+
+	var name string
+	if err := br.QueryRow().Scan(&name); err != nil {
+		t.Fatalf("QueryRow().Scan() failed: %v", err)
+	}
+	if name != "bob" {
+		t.Fatalf("expected bob, got %q", name)
+	}
+
+	rows, err := br.Query()
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+	var names []string
+	for rows.Next() {
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Scan() failed: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Rows.Close() failed: %v", err)
+	}
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	// Close runs the statements whose results were not read.
+	if err := br.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if _, err := br.Exec(); !errors.Is(err, ds.ErrBatchClosed) {
+		t.Fatalf("Exec() after Close() expected ds.ErrBatchClosed, got %v", err)
+	}
+
+	if n := c.count(t); n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+}
+
+func testBatchInTx(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	tx, err := c.primary(t).Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin() failed: %v", err)
+	}
+
+	b := &ds.Batch{}
+	b.Queue(c.insertSQL(), 1, "alice")
+	b.Queue(c.insertSQL(), 1, "duplicate")
+	b.Queue(c.insertSQL(), 2, "bob")
+
+	br := tx.SendBatch(ctx, b)
+	if _, err := br.Exec(); err != nil {
+		t.Fatalf("first Exec() failed: %v", err)
+	}
+	if _, err := br.Exec(); err == nil {
+		t.Fatal("duplicate key insert expected error")
+	}
+	if _, err := br.Exec(); err == nil {
+		t.Fatal("statement after a failed one expected error")
+	}
+	if _, err := br.Exec(); !errors.Is(err, ds.ErrNoBatchResults) {
+		t.Fatalf("Exec() past the batch expected ds.ErrNoBatchResults, got %v", err)
+	}
+	if err := br.Close(); err == nil {
+		t.Fatal("Close() expected the batch error")
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	if n := c.count(t); n != 0 {
+		t.Fatalf("expected no rows after rollback, got %d", n)
+	}
+}
+
+func testCopyFrom(t *testing.T, c *conformance) {
+	ctx := context.Background()
+
+	rows := make([][]any, 1500)
+	for i := range rows {
+		rows[i] = []any{i + 1, fmt.Sprintf("user%d", i+1)}
+	}
+
+	err := ds.WithTx(ctx, c.primary(t), func(ctx context.Context, tx ds.Tx) error {
+		n, err := ds.CopyFrom(ctx, tx, c.table, []string{"id", "name"}, ds.CopyFromRows(rows))
+		if err != nil {
+			return err
+		}
+		if n != int64(len(rows)) {
+			t.Fatalf("expected %d rows copied, got %d", len(rows), n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CopyFrom() failed: %v", err)
+	}
+
+	if n := c.count(t); n != int64(len(rows)) {
+		t.Fatalf("expected %d rows, got %d", len(rows), n)
+	}
+
+	var name string
+	if err := c.primary(t).QueryRow(ctx, "SELECT name FROM "+c.table+" WHERE id = $1", 1500).Scan(&name); err != nil {
+		t.Fatalf("QueryRow() failed: %v", err)
+	}
+	if name != "user1500" {
+		t.Fatalf("expected user1500, got %q", name)
+	}
+}
+
+func testPreparedStatement(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	conn := c.primary(t)
+
+	ins, err := conn.Prepare(ctx, c.table+"_insert", c.insertSQL())
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	if ins.Name() != c.table+"_insert" {
+		t.Fatalf("Name() returned %q", ins.Name())
+	}
+
+	for i, name := range []string{"alice", "bob"} {
+		res, err := ins.Exec(ctx, i+1, name)
+		if err != nil {
+			t.Fatalf("Exec() failed: %v", err)
+		}
+		if res.RowsAffected() != 1 {
+			t.Fatalf("expected 1 row affected, got %d", res.RowsAffected())
+		}
+	}
+
+	sel, err := conn.Prepare(ctx, c.table+"_select", "SELECT name FROM "+c.table+" WHERE id = $1")
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+
+	var name string
+	if err := sel.QueryRow(ctx, 2).Scan(&name); err != nil {
+		t.Fatalf("QueryRow() failed: %v", err)
+	}
+	if name != "bob" {
+		t.Fatalf("expected bob, got %q", name)
+	}
+	if err := sel.QueryRow(ctx, 3).Scan(&name); !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("QueryRow() expected ds.ErrNoRows, got %v", err)
+	}
+
+	rows, err := sel.Query(ctx, 1)
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 row, got %d", n)
+	}
+}
+
+func testPreparedStatementScopedToConn(t *testing.T, c *conformance) {
+	ctx := context.Background()
+	name := c.table + "_stmt"
+
+	c.exec(t, c.insertSQL(), 1, "alice")
+
+	// The same statement name on two leased connections
+	// must not collide.
+	first := c.primary(t)
+	second := c.primary(t)
+
+	s1, err := first.Prepare(ctx, name, "SELECT name FROM "+c.table+" WHERE id = $1")
+	if err != nil {
+		t.Fatalf("Prepare() on first connection failed: %v", err)
+	}
+	s2, err := second.Prepare(ctx, name, "SELECT id FROM "+c.table+" WHERE name = $1")
+	if err != nil {
+		t.Fatalf("Prepare() on second connection failed: %v", err)
+	}
+
+	var got string
+	if err := s1.QueryRow(ctx, 1).Scan(&got); err != nil {
+		t.Fatalf("first statement failed: %v", err)
+	}
+	if got != "alice" {
+		t.Fatalf("expected alice, got %q", got)
+	}
+
+	var id int64
+	if err := s2.QueryRow(ctx, "alice").Scan(&id); err != nil {
+		t.Fatalf("second statement failed: %v", err)
+	}
+	if id != 1 {
+		t.Fatalf("expected 1, got %d", id)
+	}
+}
@@ -0,0 +1,554 @@
+// Package dstest provides an in-memory ds.Provider for unit tests.
+//
+// The provider is driven by scripted expectations, in the spirit of
+// sqlmock: every acquisition, query, prepared statement and transaction
+// step must be expected in order. When the test ends the provider
+// reports unfulfilled expectations and leased connections that were
+// never released.
+package dstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+)
+
+const (
+	// PrimaryID is returned by GetPrimary unless scripted otherwise.
+	PrimaryID = ds.ServerID("primary")
+	// SecondaryID is returned by GetSecondary unless scripted otherwise.
+	SecondaryID = ds.ServerID("secondary")
+)
+
+var (
+	ErrProviderClosed = errors.New("dstest: provider is closed")
+	ErrConnReleased   = errors.New("dstest: connection has already been released")
+)
+
+//
+// ---------- Provider ----------
+//
+
+// Provider is a scriptable ds.Provider.
+type Provider struct {
+	mu       sync.Mutex
+	expected []expectation
+	leases   []*poolConn
+	closed   bool
+}
+
+var _ ds.Provider = (*Provider)(nil)
+
+// New returns an empty Provider. When t is not nil, ExpectationsWereMet
+// is checked automatically at the end of the test.
+func New(t testing.TB) *Provider {
+	p := &Provider{}
+
+	if t != nil {
+		t.Cleanup(func() {
+			if err := p.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	return p
+}
+
+// ExpectationsWereMet reports expectations that were not triggered
+// and connections that were acquired but not released.
+func (p *Provider) ExpectationsWereMet() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, e := range p.expected {
+		if !e.triggered() {
+			errs = append(errs, fmt.Errorf("dstest: expectation was not met: %s", e))
+		}
+	}
+	for _, pc := range p.leases {
+		if !pc.released {
+			errs = append(errs, fmt.Errorf("dstest: connection to %s was not released", pc.id))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ExpectGetPrimary expects a GetPrimary call.
+func (p *Provider) ExpectGetPrimary() *ExpectedAcquire {
+	e := &ExpectedAcquire{secondary: false, id: PrimaryID}
+	p.expect(e)
+	return e
+}
+
+// ExpectGetSecondary expects a GetSecondary call with any minLSN.
+func (p *Provider) ExpectGetSecondary() *ExpectedAcquire {
+	e := &ExpectedAcquire{secondary: true, id: SecondaryID}
+	p.expect(e)
+	return e
+}
+
+// ExpectExec expects Exec with SQL matching the sqlRegexp.
+func (p *Provider) ExpectExec(sqlRegexp string) *ExpectedExec {
+	e := &ExpectedExec{queryMatcher: newQueryMatcher(sqlRegexp)}
+	p.expect(e)
+	return e
+}
+
+// ExpectQuery expects Query or QueryRow with SQL matching the sqlRegexp.
+func (p *Provider) ExpectQuery(sqlRegexp string) *ExpectedQuery {
+	e := &ExpectedQuery{queryMatcher: newQueryMatcher(sqlRegexp)}
+	p.expect(e)
+	return e
+}
+
+// ExpectPrepare expects Prepare with SQL matching the sqlRegexp.
+// An empty name matches any statement name.
+func (p *Provider) ExpectPrepare(name, sqlRegexp string) *ExpectedPrepare {
+	e := &ExpectedPrepare{name: name, queryMatcher: newQueryMatcher(sqlRegexp)}
+	p.expect(e)
+	return e
+}
+
+// ExpectBegin expects a transaction to be started,
+// or a nested one when Begin is called on a transaction.
+func (p *Provider) ExpectBegin() *ExpectedBegin {
+	e := &ExpectedBegin{}
+	p.expect(e)
+	return e
+}
+
+// ExpectCommit expects a transaction to be committed.
+func (p *Provider) ExpectCommit() *ExpectedCommit {
+	e := &ExpectedCommit{}
+	p.expect(e)
+	return e
+}
+
+// ExpectRollback expects a transaction to be rolled back.
+func (p *Provider) ExpectRollback() *ExpectedRollback {
+	e := &ExpectedRollback{}
+	p.expect(e)
+	return e
+}
+
+func (p *Provider) GetPrimary(ctx context.Context) (ds.PoolConn, ds.ServerID, error) {
+	return p.acquire(ctx, false, "")
+}
+
+func (p *Provider) GetSecondary(
+	ctx context.Context,
+	minLSN string,
+) (ds.PoolConn, ds.ServerID, error) {
+	return p.acquire(ctx, true, minLSN)
+}
+
+func (p *Provider) Release(pc ds.PoolConn, _ ds.ServerID) {
+	if pc != nil {
+		pc.Release()
+	}
+}
+
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	return nil
+}
+
+func (p *Provider) acquire(
+	ctx context.Context,
+	secondary bool,
+	minLSN string,
+) (ds.PoolConn, ds.ServerID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	call := "GetPrimary()"
+	if secondary {
+		call = fmt.Sprintf("GetSecondary(%q)", minLSN)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, "", ErrProviderClosed
+	}
+
+	e, err := nextExpectation[*ExpectedAcquire](p, call)
+	if err != nil {
+		return nil, "", err
+	}
+	if e.secondary != secondary {
+		return nil, "", fmt.Errorf("dstest: call %s does not match expectation %s", call, e)
+	}
+	if e.minLSN != nil && *e.minLSN != minLSN {
+		return nil, "", fmt.Errorf("dstest: call %s does not match expectation %s", call, e)
+	}
+	if e.err != nil {
+		return nil, "", e.err
+	}
+
+	pc := &poolConn{provider: p, id: e.id}
+	p.leases = append(p.leases, pc)
+
+	return pc, e.id, nil
+}
+
+func (p *Provider) expect(e expectation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expected = append(p.expected, e)
+}
+
+// nextExpectation marks the next pending expectation as triggered and
+// returns it when it has type E. p.mu must be held.
+func nextExpectation[E expectation](p *Provider, call string) (E, error) {
+	var zero E
+
+	for _, e := range p.expected {
+		if e.triggered() {
+			continue
+		}
+
+		typed, ok := e.(E)
+		if !ok {
+			return zero, fmt.Errorf("dstest: call %s was not expected, next expectation is %s", call, e)
+		}
+		typed.trigger()
+
+		return typed, nil
+	}
+
+	return zero, fmt.Errorf("dstest: call %s was not expected, all expectations were already met", call)
+}
+
+// next is nextExpectation for callers that do not hold p.mu.
+func next[E expectation](p *Provider, call string) (E, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return nextExpectation[E](p, call)
+}
+
+//
+// ---------- PoolConn ----------
+//
+
+type poolConn struct {
+	provider *Provider
+	id       ds.ServerID
+	released bool
+}
+
+func (pc *poolConn) Conn() ds.Conn {
+	return &conn{pc: pc}
+}
+
+func (pc *poolConn) Release() {
+	pc.provider.mu.Lock()
+	defer pc.provider.mu.Unlock()
+
+	pc.released = true
+}
+
+func (pc *poolConn) isReleased() bool {
+	pc.provider.mu.Lock()
+	defer pc.provider.mu.Unlock()
+
+	return pc.released
+}
+
+//
+// ---------- Conn ----------
+//
+
+type conn struct {
+	pc *poolConn
+}
+
+var _ ds.Conn = (*conn)(nil)
+
+func (c *conn) Exec(ctx context.Context, sql string, args ...any) (ds.ExecResult, error) {
+	if c.pc.isReleased() {
+		return nil, ErrConnReleased
+	}
+	return execute(ctx, c.pc.provider, sql, args)
+}
+
+func (c *conn) Query(ctx context.Context, sql string, args ...any) (ds.Rows, error) {
+	if c.pc.isReleased() {
+		return nil, ErrConnReleased
+	}
+	return query(ctx, c.pc.provider, sql, args)
+}
+
+func (c *conn) QueryRow(ctx context.Context, sql string, args ...any) ds.Row {
+	if c.pc.isReleased() {
+		return &row{err: ErrConnReleased}
+	}
+	return queryRow(ctx, c.pc.provider, sql, args)
+}
+
+func (c *conn) Prepare(ctx context.Context, name string, sql string) (ds.PreparedStatement, error) {
+	if c.pc.isReleased() {
+		return nil, ErrConnReleased
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e, err := next[*ExpectedPrepare](c.pc.provider, fmt.Sprintf("Prepare(%q, %q)", name, sql))
+	if err != nil {
+		return nil, err
+	}
+	if e.name != "" && e.name != name {
+		return nil, fmt.Errorf("dstest: prepared statement name %q does not match expectation %s", name, e)
+	}
+	if err := e.match(sql, nil); err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return &preparedStatement{conn: c, name: name, sql: sql}, nil
+}
+
+// SendBatch runs the batch statement by statement as results are read;
+// each statement is matched by ExpectExec or ExpectQuery.
+func (c *conn) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return ds.SendBatchSequential(ctx, c, b)
+}
+
+func (c *conn) Begin(ctx context.Context) (ds.Tx, error) {
+	return c.BeginTx(ctx, ds.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts ds.TxOptions) (ds.Tx, error) {
+	if c.pc.isReleased() {
+		return nil, ErrConnReleased
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e, err := next[*ExpectedBegin](c.pc.provider, "Begin()")
+	if err != nil {
+		return nil, err
+	}
+	if e.opts != nil && *e.opts != opts {
+		return nil, fmt.Errorf("dstest: Begin() called with options %+v, expected %+v", opts, *e.opts)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return &tx{conn: c}, nil
+}
+
+//
+// ---------- Prepared statement ----------
+//
+
+type preparedStatement struct {
+	conn *conn
+	name string
+	sql  string
+}
+
+var _ ds.PreparedStatement = (*preparedStatement)(nil)
+
+func (s *preparedStatement) Exec(ctx context.Context, args ...any) (ds.ExecResult, error) {
+	return s.conn.Exec(ctx, s.sql, args...)
+}
+
+func (s *preparedStatement) Query(ctx context.Context, args ...any) (ds.Rows, error) {
+	return s.conn.Query(ctx, s.sql, args...)
+}
+
+func (s *preparedStatement) QueryRow(ctx context.Context, args ...any) ds.Row {
+	return s.conn.QueryRow(ctx, s.sql, args...)
+}
+
+func (s *preparedStatement) Name() string {
+	return s.name
+}
+
+//
+// ---------- Tx ----------
+//
+
+type tx struct {
+	conn *conn
+	// parent is the enclosing transaction of a nested one.
+	parent *tx
+
+	mu   sync.Mutex
+	done bool
+}
+
+var _ ds.Tx = (*tx)(nil)
+
+func (t *tx) Exec(ctx context.Context, sql string, args ...any) (ds.ExecResult, error) {
+	if t.isDone() {
+		return nil, ds.ErrTxDone
+	}
+	return t.conn.Exec(ctx, sql, args...)
+}
+
+func (t *tx) Query(ctx context.Context, sql string, args ...any) (ds.Rows, error) {
+	if t.isDone() {
+		return nil, ds.ErrTxDone
+	}
+	return t.conn.Query(ctx, sql, args...)
+}
+
+func (t *tx) QueryRow(ctx context.Context, sql string, args ...any) ds.Row {
+	if t.isDone() {
+		return &row{err: ds.ErrTxDone}
+	}
+	return t.conn.QueryRow(ctx, sql, args...)
+}
+
+// SendBatch runs the batch statement by statement as results are read.
+func (t *tx) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return ds.SendBatchSequential(ctx, t, b)
+}
+
+// Begin matches an ExpectBegin and starts a nested transaction.
+func (t *tx) Begin(ctx context.Context) (ds.Tx, error) {
+	if t.isDone() {
+		return nil, ds.ErrTxDone
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e, err := next[*ExpectedBegin](t.conn.pc.provider, "Begin()")
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return &tx{conn: t.conn, parent: t}, nil
+}
+
+// Commit matches an ExpectCommit. A scripted commit failure leaves the
+// transaction open, so callers may still be expected to roll it back.
+func (t *tx) Commit(context.Context) error {
+	if t.isDone() {
+		return ds.ErrTxDone
+	}
+
+	e, err := next[*ExpectedCommit](t.conn.pc.provider, "Commit()")
+	if err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	t.finish()
+	return nil
+}
+
+func (t *tx) Rollback(context.Context) error {
+	if t.isDone() {
+		return ds.ErrTxDone
+	}
+
+	e, err := next[*ExpectedRollback](t.conn.pc.provider, "Rollback()")
+	if err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	t.finish()
+	return nil
+}
+
+func (t *tx) isDone() bool {
+	t.mu.Lock()
+	done := t.done
+	t.mu.Unlock()
+
+	return done || (t.parent != nil && t.parent.isDone())
+}
+
+func (t *tx) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done = true
+}
+
+//
+// ---------- Query execution ----------
+//
+
+func execute(ctx context.Context, p *Provider, sql string, args []any) (ds.ExecResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e, err := next[*ExpectedExec](p, fmt.Sprintf("Exec(%q)", sql))
+	if err != nil {
+		return nil, err
+	}
+	if err := e.match(sql, args); err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return execResult(e.rowsAffected), nil
+}
+
+func query(ctx context.Context, p *Provider, sql string, args []any) (ds.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e, err := next[*ExpectedQuery](p, fmt.Sprintf("Query(%q)", sql))
+	if err != nil {
+		return nil, err
+	}
+	if err := e.match(sql, args); err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return e.rows.cursor(), nil
+}
+
+func queryRow(ctx context.Context, p *Provider, sql string, args []any) ds.Row {
+	rows, err := query(ctx, p, sql, args)
+	if err != nil {
+		return &row{err: err}
+	}
+	return &row{rows: rows}
+}
+
+type execResult int64
+
+func (r execResult) RowsAffected() int64 {
+	return int64(r)
+}
@@ -0,0 +1,236 @@
+package dstest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+func TestScriptedQueries(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(t)
+
+	p.ExpectGetSecondary().WithMinLSN("0/1").WillReturnServerID("replica1")
+	p.ExpectQuery(`SELECT id, name FROM users`).
+		WillReturnRows(dstest.NewRows("id", "name").AddRow(1, "alice").AddRow(2, "bob"))
+	p.ExpectExec(`UPDATE users`).WithArgs("carol", dstest.AnyArg()).WillReturnResult(1)
+
+	pc, id, err := p.GetSecondary(ctx, "0/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Release(pc, id)
+
+	if id != "replica1" {
+		t.Fatalf("expected replica1, got %s", id)
+	}
+
+	rows, err := pc.Conn().Query(ctx, "SELECT id, name FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if strings.Join(names, ",") != "alice,bob" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	res, err := pc.Conn().Exec(ctx, "UPDATE users SET name = $1 WHERE id = $2", "carol", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.RowsAffected() != 1 {
+		t.Fatalf("expected 1 row affected, got %d", res.RowsAffected())
+	}
+}
+
+func TestQueryRowNoRows(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(t)
+
+	p.ExpectGetPrimary()
+	p.ExpectQuery(`SELECT name`).WillReturnRows(dstest.NewRows("name"))
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	var name string
+	err = pc.Conn().QueryRow(ctx, "SELECT name FROM users").Scan(&name)
+	if !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("expected ds.ErrNoRows, got %v", err)
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(t)
+
+	p.ExpectGetPrimary()
+	p.ExpectPrepare("user_by_id", `SELECT name FROM users WHERE id`)
+	p.ExpectQuery(`SELECT name FROM users WHERE id`).
+		WithArgs(1).
+		WillReturnRows(dstest.NewRows("name").AddRow("alice"))
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	stmt, err := pc.Conn().Prepare(ctx, "user_by_id", "SELECT name FROM users WHERE id = $1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stmt.Name() != "user_by_id" {
+		t.Fatalf("unexpected statement name %q", stmt.Name())
+	}
+
+	var name string
+	if err := stmt.QueryRow(ctx, 1).Scan(&name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "alice" {
+		t.Fatalf("expected alice, got %q", name)
+	}
+}
+
+func TestUnexpectedCall(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(t)
+
+	p.ExpectGetPrimary()
+	p.ExpectExec(`INSERT`)
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	if _, err := pc.Conn().Query(ctx, "SELECT 1"); err == nil {
+		t.Fatal("expected error for out of order call")
+	}
+	if _, err := pc.Conn().Exec(ctx, "INSERT INTO users DEFAULT VALUES"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestArgsMismatch(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(t)
+
+	p.ExpectGetPrimary()
+	p.ExpectExec(`INSERT`).WithArgs("alice")
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	if _, err := pc.Conn().Exec(ctx, "INSERT INTO users(name) VALUES($1)", "bob"); err == nil {
+		t.Fatal("expected error for mismatched args")
+	}
+}
+
+func TestExpectationsWereMet(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(nil)
+
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+
+	if _, _, err := p.GetPrimary(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := p.ExpectationsWereMet()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "Begin()") {
+		t.Fatalf("expected unmet Begin, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "not released") {
+		t.Fatalf("expected leaked connection, got %v", err)
+	}
+}
+
+func TestAcquireError(t *testing.T) {
+	expectedErr := errors.New("no primary")
+	p := dstest.New(t)
+
+	p.ExpectGetPrimary().WillReturnError(expectedErr)
+
+	_, id, err := p.GetPrimary(context.Background())
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+	if id != "" {
+		t.Fatalf("expected no server id, got %s", id)
+	}
+}
+
+func TestTxDone(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(t)
+
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectCommit()
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	tx, err := pc.Conn().Begin(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Rollback(ctx); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, got %v", err)
+	}
+}
+
+func TestBeginWithOptions(t *testing.T) {
+	ctx := context.Background()
+	p := dstest.New(nil)
+
+	p.ExpectGetPrimary()
+	p.ExpectBegin().WithOptions(ds.TxOptions{Isolation: ds.IsolationSerializable})
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	if _, err := pc.Conn().Begin(ctx); err == nil {
+		t.Fatal("expected error for mismatched options")
+	}
+}
@@ -0,0 +1,254 @@
+package dstest
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/dronm/ds/v4"
+)
+
+type expectation interface {
+	fmt.Stringer
+	triggered() bool
+	trigger()
+}
+
+type commonExpectation struct {
+	done bool
+	err  error
+}
+
+func (e *commonExpectation) triggered() bool { return e.done }
+func (e *commonExpectation) trigger()        { e.done = true }
+
+// Argument matches a single query argument.
+type Argument interface {
+	Match(v any) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(any) bool { return true }
+
+// AnyArg matches any argument value.
+func AnyArg() Argument {
+	return anyArg{}
+}
+
+type queryMatcher struct {
+	re      *regexp.Regexp
+	args    []any
+	argsSet bool
+}
+
+func newQueryMatcher(sqlRegexp string) queryMatcher {
+	return queryMatcher{re: regexp.MustCompile(sqlRegexp)}
+}
+
+func (m *queryMatcher) match(sql string, args []any) error {
+	if !m.re.MatchString(sql) {
+		return fmt.Errorf("dstest: SQL %q does not match %q", sql, m.re)
+	}
+	if !m.argsSet {
+		return nil
+	}
+	if len(args) != len(m.args) {
+		return fmt.Errorf("dstest: SQL %q called with %d args, expected %d", sql, len(args), len(m.args))
+	}
+
+	for i, want := range m.args {
+		if a, ok := want.(Argument); ok {
+			if !a.Match(args[i]) {
+				return fmt.Errorf("dstest: SQL %q argument %d (%v) does not match", sql, i, args[i])
+			}
+			continue
+		}
+		if !reflect.DeepEqual(want, args[i]) {
+			return fmt.Errorf("dstest: SQL %q argument %d is %#v, expected %#v", sql, i, args[i], want)
+		}
+	}
+
+	return nil
+}
+
+//
+// ---------- Acquire ----------
+//
+
+// ExpectedAcquire is an expected GetPrimary or GetSecondary call.
+type ExpectedAcquire struct {
+	commonExpectation
+	secondary bool
+	minLSN    *string
+	id        ds.ServerID
+}
+
+// WithMinLSN requires GetSecondary to be called with minLSN.
+func (e *ExpectedAcquire) WithMinLSN(minLSN string) *ExpectedAcquire {
+	e.minLSN = &minLSN
+	return e
+}
+
+// WillReturnServerID sets the ServerID reported for the connection.
+func (e *ExpectedAcquire) WillReturnServerID(id ds.ServerID) *ExpectedAcquire {
+	e.id = id
+	return e
+}
+
+// WillReturnError makes the acquisition fail with err.
+func (e *ExpectedAcquire) WillReturnError(err error) *ExpectedAcquire {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedAcquire) String() string {
+	if !e.secondary {
+		return "GetPrimary()"
+	}
+	if e.minLSN != nil {
+		return fmt.Sprintf("GetSecondary(%q)", *e.minLSN)
+	}
+	return "GetSecondary()"
+}
+
+//
+// ---------- Exec ----------
+//
+
+// ExpectedExec is an expected Exec call.
+type ExpectedExec struct {
+	commonExpectation
+	queryMatcher
+	rowsAffected int64
+}
+
+// WithArgs requires the call to be made with args. Values implementing
+// Argument are matched with it, others with reflect.DeepEqual.
+func (e *ExpectedExec) WithArgs(args ...any) *ExpectedExec {
+	e.args, e.argsSet = args, true
+	return e
+}
+
+// WillReturnResult sets the number of rows reported as affected.
+func (e *ExpectedExec) WillReturnResult(rowsAffected int64) *ExpectedExec {
+	e.rowsAffected = rowsAffected
+	return e
+}
+
+// WillReturnError makes Exec fail with err.
+func (e *ExpectedExec) WillReturnError(err error) *ExpectedExec {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedExec) String() string {
+	return fmt.Sprintf("Exec(%q)", e.re)
+}
+
+//
+// ---------- Query ----------
+//
+
+// ExpectedQuery is an expected Query or QueryRow call.
+type ExpectedQuery struct {
+	commonExpectation
+	queryMatcher
+	rows *Rows
+}
+
+// WithArgs requires the call to be made with args. Values implementing
+// Argument are matched with it, others with reflect.DeepEqual.
+func (e *ExpectedQuery) WithArgs(args ...any) *ExpectedQuery {
+	e.args, e.argsSet = args, true
+	return e
+}
+
+// WillReturnRows sets the result set returned by the query.
+func (e *ExpectedQuery) WillReturnRows(rows *Rows) *ExpectedQuery {
+	e.rows = rows
+	return e
+}
+
+// WillReturnError makes the query fail with err.
+func (e *ExpectedQuery) WillReturnError(err error) *ExpectedQuery {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedQuery) String() string {
+	return fmt.Sprintf("Query(%q)", e.re)
+}
+
+//
+// ---------- Prepare ----------
+//
+
+// ExpectedPrepare is an expected Prepare call. Statement executions
+// are matched by ExpectExec and ExpectQuery against the prepared SQL.
+type ExpectedPrepare struct {
+	commonExpectation
+	queryMatcher
+	name string
+}
+
+// WillReturnError makes Prepare fail with err.
+func (e *ExpectedPrepare) WillReturnError(err error) *ExpectedPrepare {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedPrepare) String() string {
+	return fmt.Sprintf("Prepare(%q, %q)", e.name, e.re)
+}
+
+//
+// ---------- Transactions ----------
+//
+
+// ExpectedBegin is an expected Begin call.
+type ExpectedBegin struct {
+	commonExpectation
+	opts *ds.TxOptions
+}
+
+// WithOptions requires the transaction to be started with opts.
+// Without it any options match.
+func (e *ExpectedBegin) WithOptions(opts ds.TxOptions) *ExpectedBegin {
+	e.opts = &opts
+	return e
+}
+
+// WillReturnError makes Begin fail with err.
+func (e *ExpectedBegin) WillReturnError(err error) *ExpectedBegin {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedBegin) String() string { return "Begin()" }
+
+// ExpectedCommit is an expected Commit call.
+type ExpectedCommit struct {
+	commonExpectation
+}
+
+// WillReturnError makes Commit fail with err.
+func (e *ExpectedCommit) WillReturnError(err error) *ExpectedCommit {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedCommit) String() string { return "Commit()" }
+
+// ExpectedRollback is an expected Rollback call.
+type ExpectedRollback struct {
+	commonExpectation
+}
+
+// WillReturnError makes Rollback fail with err.
+func (e *ExpectedRollback) WillReturnError(err error) *ExpectedRollback {
+	e.err = err
+	return e
+}
+
+func (e *ExpectedRollback) String() string { return "Rollback()" }
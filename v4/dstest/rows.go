@@ -0,0 +1,192 @@
+package dstest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/dronm/ds/v4"
+)
+
+// Rows is a scripted result set.
+type Rows struct {
+	columns  []string
+	values   [][]any
+	rowErrs  map[int]error
+	closeErr error
+}
+
+// NewRows returns an empty result set with the given columns.
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// AddRow appends a row. It panics if the number of values
+// does not match the number of columns.
+func (r *Rows) AddRow(values ...any) *Rows {
+	if len(values) != len(r.columns) {
+		panic(fmt.Sprintf("dstest: row has %d values, expected %d", len(values), len(r.columns)))
+	}
+
+	r.values = append(r.values, values)
+	return r
+}
+
+// RowError makes iteration stop with err when row is reached.
+func (r *Rows) RowError(row int, err error) *Rows {
+	if r.rowErrs == nil {
+		r.rowErrs = make(map[int]error)
+	}
+	r.rowErrs[row] = err
+	return r
+}
+
+// CloseError makes Close return err.
+func (r *Rows) CloseError(err error) *Rows {
+	r.closeErr = err
+	return r
+}
+
+func (r *Rows) cursor() *rows {
+	if r == nil {
+		return &rows{def: &Rows{}, pos: -1}
+	}
+	return &rows{def: r, pos: -1}
+}
+
+//
+// ---------- Rows / Row ----------
+//
+
+type rows struct {
+	def    *Rows
+	pos    int
+	err    error
+	closed bool
+}
+
+var _ ds.Rows = (*rows)(nil)
+
+func (r *rows) Close() error {
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+
+	if r.err != nil {
+		return r.err
+	}
+	return r.def.closeErr
+}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+func (r *rows) Next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+
+	r.pos++
+	if err, ok := r.def.rowErrs[r.pos]; ok {
+		r.err = err
+		r.closed = true
+		return false
+	}
+	if r.pos >= len(r.def.values) {
+		r.closed = true
+		return false
+	}
+
+	return true
+}
+
+func (r *rows) Columns() ([]string, error) {
+	return r.def.columns, nil
+}
+
+func (r *rows) Scan(dest ...any) error {
+	if r.pos < 0 || r.pos >= len(r.def.values) {
+		return ds.ErrNoRows
+	}
+
+	values := r.def.values[r.pos]
+	if len(dest) != len(values) {
+		return fmt.Errorf("dstest: Scan got %d destinations, row has %d columns", len(dest), len(values))
+	}
+
+	for i, v := range values {
+		if err := assign(dest[i], v); err != nil {
+			return fmt.Errorf("dstest: column %q: %w", r.def.columns[i], err)
+		}
+	}
+
+	return nil
+}
+
+type row struct {
+	rows ds.Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return ds.ErrNoRows
+	}
+
+	return r.rows.Scan(dest...)
+}
+
+// assign stores src in the value dest points to, converting
+// between compatible types the way database drivers do.
+func assign(dest, src any) error {
+	if s, ok := dest.(sql.Scanner); ok {
+		return s.Scan(src)
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+	dv = dv.Elem()
+
+	if src == nil {
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	switch {
+	case sv.Type().AssignableTo(dv.Type()):
+		dv.Set(sv)
+	case dv.Kind() == reflect.Pointer && sv.Type().AssignableTo(dv.Type().Elem()):
+		p := reflect.New(dv.Type().Elem())
+		p.Elem().Set(sv)
+		dv.Set(p)
+	case convertible(sv.Kind(), dv.Kind()) && sv.Type().ConvertibleTo(dv.Type()):
+		dv.Set(sv.Convert(dv.Type()))
+	default:
+		return fmt.Errorf("cannot assign %T to %s", src, dv.Type())
+	}
+
+	return nil
+}
+
+func convertible(from, to reflect.Kind) bool {
+	numeric := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	if numeric(from) && numeric(to) {
+		return true
+	}
+	return from == to
+}
@@ -0,0 +1,103 @@
+package ds
+
+import "errors"
+
+// ErrorCode is the provider-neutral class of a database error.
+type ErrorCode int
+
+const (
+	CodeUnknown ErrorCode = iota
+	CodeUniqueViolation
+	CodeForeignKeyViolation
+	CodeNotNullViolation
+	CodeCheckViolation
+	CodeSerializationFailure
+	CodeDeadlock
+	CodeConnectionLost
+	CodeQueryCanceled
+	CodeReadOnlyTransaction
+)
+
+func (c ErrorCode) String() string {
+	switch c {
+	case CodeUniqueViolation:
+		return "unique violation"
+	case CodeForeignKeyViolation:
+		return "foreign key violation"
+	case CodeNotNullViolation:
+		return "not-null violation"
+	case CodeCheckViolation:
+		return "check violation"
+	case CodeSerializationFailure:
+		return "serialization failure"
+	case CodeDeadlock:
+		return "deadlock"
+	case CodeConnectionLost:
+		return "connection lost"
+	case CodeQueryCanceled:
+		return "query canceled"
+	case CodeReadOnlyTransaction:
+		return "read-only transaction"
+	}
+	return "unknown"
+}
+
+// Sentinels matching classified errors of each code with errors.Is:
+//
+//	if errors.Is(err, ds.ErrUniqueViolation) {
+//		return http.StatusConflict
+//	}
+var (
+	ErrUniqueViolation      = &Error{Code: CodeUniqueViolation}
+	ErrForeignKeyViolation  = &Error{Code: CodeForeignKeyViolation}
+	ErrNotNullViolation     = &Error{Code: CodeNotNullViolation}
+	ErrCheckViolation       = &Error{Code: CodeCheckViolation}
+	ErrSerializationFailure = &Error{Code: CodeSerializationFailure}
+	ErrDeadlock             = &Error{Code: CodeDeadlock}
+	ErrConnectionLost       = &Error{Code: CodeConnectionLost}
+	ErrQueryCanceled        = &Error{Code: CodeQueryCanceled}
+	ErrReadOnlyTransaction  = &Error{Code: CodeReadOnlyTransaction}
+)
+
+// Error is a database error classified by a provider. It wraps the
+// driver error, so driver-specific checks keep working.
+type Error struct {
+	Code ErrorCode
+	// DriverCode is the code reported by the driver,
+	// such as a SQLSTATE. Empty if the driver reports none.
+	DriverCode string
+
+	// Constraint, Table and Column name the objects involved,
+	// when the driver reports them.
+	Constraint string
+	Table      string
+	Column     string
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return "ds: " + e.Code.String()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel of e.Code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Err == nil && t.Code == e.Code
+}
+
+// ErrorDetails returns the classified Error in err's chain.
+func ErrorDetails(err error) (*Error, bool) {
+	var e *Error
+	if !errors.As(err, &e) || e.Err == nil {
+		return nil, false
+	}
+	return e, true
+}
@@ -0,0 +1,63 @@
+package ds_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+)
+
+func TestErrorMatchesSentinel(t *testing.T) {
+	driverErr := errors.New(`duplicate key value violates unique constraint "users_email_key"`)
+	err := fmt.Errorf("create user: %w", &ds.Error{
+		Code:       ds.CodeUniqueViolation,
+		DriverCode: "23505",
+		Constraint: "users_email_key",
+		Table:      "users",
+		Err:        driverErr,
+	})
+
+	if !errors.Is(err, ds.ErrUniqueViolation) {
+		t.Fatal("expected ErrUniqueViolation to match")
+	}
+	if errors.Is(err, ds.ErrForeignKeyViolation) {
+		t.Fatal("expected ErrForeignKeyViolation not to match")
+	}
+	if !errors.Is(err, driverErr) {
+		t.Fatal("expected the driver error to be unwrapped")
+	}
+	if err.Error() != "create user: "+driverErr.Error() {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+
+	details, ok := ds.ErrorDetails(err)
+	if !ok {
+		t.Fatal("expected details")
+	}
+	if details.Constraint != "users_email_key" || details.Table != "users" || details.DriverCode != "23505" {
+		t.Fatalf("unexpected details: %+v", details)
+	}
+}
+
+func TestErrorDetailsOfUnclassifiedError(t *testing.T) {
+	if _, ok := ds.ErrorDetails(errors.New("boom")); ok {
+		t.Fatal("expected no details for a plain error")
+	}
+	if _, ok := ds.ErrorDetails(ds.ErrDeadlock); ok {
+		t.Fatal("expected no details for a sentinel")
+	}
+	if ds.ErrDeadlock.Error() != "ds: deadlock" {
+		t.Fatalf("unexpected sentinel message %q", ds.ErrDeadlock.Error())
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	retryable := &ds.Error{Code: ds.CodeSerializationFailure, Err: errors.New("could not serialize")}
+	if !ds.IsRetryable(fmt.Errorf("commit: %w", retryable)) {
+		t.Fatal("expected serialization failures to be retryable")
+	}
+	if ds.IsRetryable(&ds.Error{Code: ds.CodeUniqueViolation, Err: errors.New("duplicate")}) {
+		t.Fatal("expected unique violations not to be retryable")
+	}
+}
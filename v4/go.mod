@@ -2,7 +2,10 @@ module github.com/dronm/ds/v4
 
 go 1.24.3
 
-require github.com/jackc/pgx/v5 v5.8.0
+require (
+	github.com/jackc/pgx/v5 v5.8.0
+	github.com/mattn/go-sqlite3 v1.14.33
+)
 
 require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
@@ -0,0 +1,506 @@
+package ds
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// Op identifies the operation reported to a Hook.
+type Op string
+
+const (
+	OpExec     Op = "exec"
+	OpQuery    Op = "query"
+	OpQueryRow Op = "query_row"
+	OpPrepare  Op = "prepare"
+	OpBegin    Op = "begin"
+	OpCommit   Op = "commit"
+	OpRollback Op = "rollback"
+	OpBatch    Op = "batch"
+	OpCopyFrom Op = "copy_from"
+	OpCopyTo   Op = "copy_to"
+	// OpCurrentLSN reads the WAL position for a ConsistencyToken.
+	OpCurrentLSN Op = "current_lsn"
+)
+
+// QueryEvent describes a single operation on a connection,
+// transaction or prepared statement.
+type QueryEvent struct {
+	Op       Op
+	ServerID ServerID
+	SQL      string
+	Args     []any
+	// Statement is the prepared statement name, empty for plain queries.
+	Statement string
+	// InTx reports whether the operation runs inside a transaction.
+	InTx bool
+	// Nested reports whether a Begin, Commit or Rollback applies
+	// to a nested, savepoint-backed transaction.
+	Nested bool
+	// Batch lists the statements of an OpBatch event.
+	Batch []BatchQuery
+
+	// The fields below are set before After is called.
+	Start        time.Time
+	Duration     time.Duration
+	RowsAffected int64
+	Err          error
+}
+
+// Hook observes operations flowing through a leased connection.
+//
+// Before is called before the operation and may replace SQL and Args
+// of plain queries; the returned context is used for the operation and
+// passed to After. After is called once the operation completes. For
+// QueryRow the operation completes when Scan returns, for Query when
+// the first response is received, for SendBatch when the results are
+// closed. RowsAffected of a batch sums the Exec results read.
+type Hook interface {
+	Before(ctx context.Context, ev *QueryEvent) context.Context
+	After(ctx context.Context, ev *QueryEvent)
+}
+
+// HookFuncs adapts plain functions to Hook. Nil functions are skipped.
+type HookFuncs struct {
+	BeforeFunc func(ctx context.Context, ev *QueryEvent) context.Context
+	AfterFunc  func(ctx context.Context, ev *QueryEvent)
+}
+
+func (h HookFuncs) Before(ctx context.Context, ev *QueryEvent) context.Context {
+	if h.BeforeFunc == nil {
+		return ctx
+	}
+	return h.BeforeFunc(ctx, ev)
+}
+
+func (h HookFuncs) After(ctx context.Context, ev *QueryEvent) {
+	if h.AfterFunc != nil {
+		h.AfterFunc(ctx, ev)
+	}
+}
+
+// WithHooks returns pc with every operation reported to hooks.
+// Before hooks run in order, After hooks in reverse order.
+// Providers call it on the connections they lease; pc is returned
+// unchanged when hooks is empty.
+func WithHooks(pc PoolConn, id ServerID, hooks ...Hook) PoolConn {
+	if pc == nil || len(hooks) == 0 {
+		return pc
+	}
+
+	return &hookPoolConn{
+		pc:    pc,
+		chain: hookChain{id: id, hooks: hooks},
+	}
+}
+
+type hookChain struct {
+	id    ServerID
+	hooks []Hook
+}
+
+func (c hookChain) before(ctx context.Context, ev *QueryEvent) context.Context {
+	ev.ServerID = c.id
+	for _, h := range c.hooks {
+		ctx = h.Before(ctx, ev)
+	}
+	ev.Start = time.Now()
+	return ctx
+}
+
+func (c hookChain) after(ctx context.Context, ev *QueryEvent, err error) {
+	ev.Duration = time.Since(ev.Start)
+	ev.Err = err
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		c.hooks[i].After(ctx, ev)
+	}
+}
+
+func (c hookChain) exec(
+	ctx context.Context,
+	ev *QueryEvent,
+	fn func(ctx context.Context) (ExecResult, error),
+) (ExecResult, error) {
+	ctx = c.before(ctx, ev)
+	res, err := fn(ctx)
+	if res != nil {
+		ev.RowsAffected = res.RowsAffected()
+	}
+	c.after(ctx, ev, err)
+	return res, err
+}
+
+func (c hookChain) query(
+	ctx context.Context,
+	ev *QueryEvent,
+	fn func(ctx context.Context) (Rows, error),
+) (Rows, error) {
+	ctx = c.before(ctx, ev)
+	rows, err := fn(ctx)
+	c.after(ctx, ev, err)
+	return rows, err
+}
+
+func (c hookChain) queryRow(
+	ctx context.Context,
+	ev *QueryEvent,
+	fn func(ctx context.Context) Row,
+) Row {
+	ctx = c.before(ctx, ev)
+	return &hookRow{row: fn(ctx), ctx: ctx, ev: ev, chain: c}
+}
+
+func (c hookChain) batch(
+	ctx context.Context,
+	ev *QueryEvent,
+	fn func(ctx context.Context) BatchResults,
+) BatchResults {
+	ctx = c.before(ctx, ev)
+	return &hookBatchResults{br: fn(ctx), ctx: ctx, ev: ev, chain: c}
+}
+
+// copyFrom reports CopyFrom on q, which falls back to InsertRows
+// when q has no Copier. SQL describes the copy for logging.
+func (c hookChain) copyFrom(
+	ctx context.Context,
+	ev *QueryEvent,
+	q Querier,
+	table string,
+	columns []string,
+	src CopySource,
+) (n int64, err error) {
+	ev.Op = OpCopyFrom
+	ev.SQL = "COPY " + table + " (" + strings.Join(columns, ", ") + ") FROM STDIN"
+	err = c.run(ctx, ev, func(ctx context.Context) error {
+		n, err = CopyFrom(ctx, q, table, columns, src)
+		ev.RowsAffected = n
+		return err
+	})
+	return n, err
+}
+
+func (c hookChain) copyTo(
+	ctx context.Context,
+	ev *QueryEvent,
+	q Querier,
+	query string,
+	w io.Writer,
+	opts CopyOptions,
+) (n int64, err error) {
+	ev.Op, ev.SQL = OpCopyTo, query
+	err = c.run(ctx, ev, func(ctx context.Context) error {
+		n, err = CopyTo(ctx, q, query, w, opts)
+		ev.RowsAffected = n
+		return err
+	})
+	return n, err
+}
+
+func (c hookChain) run(
+	ctx context.Context,
+	ev *QueryEvent,
+	fn func(ctx context.Context) error,
+) error {
+	ctx = c.before(ctx, ev)
+	err := fn(ctx)
+	c.after(ctx, ev, err)
+	return err
+}
+
+//
+// ---------- PoolConn ----------
+//
+
+type hookPoolConn struct {
+	pc    PoolConn
+	chain hookChain
+}
+
+func (p *hookPoolConn) Conn() Conn {
+	return &hookConn{conn: p.pc.Conn(), chain: p.chain}
+}
+
+func (p *hookPoolConn) Release() {
+	p.pc.Release()
+}
+
+//
+// ---------- Conn ----------
+//
+
+type hookConn struct {
+	conn  Conn
+	chain hookChain
+}
+
+// Unwrap returns the wrapped connection.
+func (c *hookConn) Unwrap() Conn {
+	return c.conn
+}
+
+func (c *hookConn) Exec(ctx context.Context, sql string, args ...any) (ExecResult, error) {
+	ev := &QueryEvent{Op: OpExec, SQL: sql, Args: args}
+	return c.chain.exec(ctx, ev, func(ctx context.Context) (ExecResult, error) {
+		return c.conn.Exec(ctx, ev.SQL, ev.Args...)
+	})
+}
+
+func (c *hookConn) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	ev := &QueryEvent{Op: OpQuery, SQL: sql, Args: args}
+	return c.chain.query(ctx, ev, func(ctx context.Context) (Rows, error) {
+		return c.conn.Query(ctx, ev.SQL, ev.Args...)
+	})
+}
+
+func (c *hookConn) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	ev := &QueryEvent{Op: OpQueryRow, SQL: sql, Args: args}
+	return c.chain.queryRow(ctx, ev, func(ctx context.Context) Row {
+		return c.conn.QueryRow(ctx, ev.SQL, ev.Args...)
+	})
+}
+
+func (c *hookConn) Prepare(ctx context.Context, name string, sql string) (PreparedStatement, error) {
+	var stmt PreparedStatement
+
+	ev := &QueryEvent{Op: OpPrepare, SQL: sql, Statement: name}
+	err := c.chain.run(ctx, ev, func(ctx context.Context) (err error) {
+		stmt, err = c.conn.Prepare(ctx, name, ev.SQL)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hookPreparedStatement{stmt: stmt, sql: ev.SQL, chain: c.chain}, nil
+}
+
+func (c *hookConn) SendBatch(ctx context.Context, b *Batch) BatchResults {
+	ev := &QueryEvent{Op: OpBatch, Batch: b.Queries()}
+	return c.chain.batch(ctx, ev, func(ctx context.Context) BatchResults {
+		return c.conn.SendBatch(ctx, b)
+	})
+}
+
+func (c *hookConn) CopyFrom(ctx context.Context, table string, columns []string, src CopySource) (int64, error) {
+	return c.chain.copyFrom(ctx, &QueryEvent{}, c.conn, table, columns, src)
+}
+
+func (c *hookConn) InsertOptions() InsertOptions {
+	return insertOptionsOf(c.conn)
+}
+
+// CurrentLSN reports the position of the wrapped connection, if it
+// has one, as an OpCurrentLSN event.
+func (c *hookConn) CurrentLSN(ctx context.Context) (lsn string, err error) {
+	r, ok := findConn[LSNReporter](c.conn)
+	if !ok {
+		return "", nil
+	}
+
+	err = c.chain.run(ctx, &QueryEvent{Op: OpCurrentLSN}, func(ctx context.Context) error {
+		lsn, err = r.CurrentLSN(ctx)
+		return err
+	})
+	return lsn, err
+}
+
+func (c *hookConn) CopyTo(ctx context.Context, query string, w io.Writer, opts CopyOptions) (int64, error) {
+	return c.chain.copyTo(ctx, &QueryEvent{}, c.conn, query, w, opts)
+}
+
+func (c *hookConn) Begin(ctx context.Context) (Tx, error) {
+	return c.begin(ctx, c.conn.Begin)
+}
+
+func (c *hookConn) BeginTx(ctx context.Context, opts TxOptions) (Tx, error) {
+	return c.begin(ctx, func(ctx context.Context) (Tx, error) {
+		return c.conn.BeginTx(ctx, opts)
+	})
+}
+
+func (c *hookConn) begin(ctx context.Context, begin func(ctx context.Context) (Tx, error)) (Tx, error) {
+	var tx Tx
+
+	ev := &QueryEvent{Op: OpBegin, InTx: true}
+	err := c.chain.run(ctx, ev, func(ctx context.Context) (err error) {
+		tx, err = begin(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hookTx{tx: tx, chain: c.chain}, nil
+}
+
+//
+// ---------- Prepared statement ----------
+//
+
+type hookPreparedStatement struct {
+	stmt  PreparedStatement
+	sql   string
+	chain hookChain
+}
+
+func (s *hookPreparedStatement) event(op Op, args []any) *QueryEvent {
+	return &QueryEvent{Op: op, SQL: s.sql, Args: args, Statement: s.stmt.Name()}
+}
+
+func (s *hookPreparedStatement) Exec(ctx context.Context, args ...any) (ExecResult, error) {
+	ev := s.event(OpExec, args)
+	return s.chain.exec(ctx, ev, func(ctx context.Context) (ExecResult, error) {
+		return s.stmt.Exec(ctx, ev.Args...)
+	})
+}
+
+func (s *hookPreparedStatement) Query(ctx context.Context, args ...any) (Rows, error) {
+	ev := s.event(OpQuery, args)
+	return s.chain.query(ctx, ev, func(ctx context.Context) (Rows, error) {
+		return s.stmt.Query(ctx, ev.Args...)
+	})
+}
+
+func (s *hookPreparedStatement) QueryRow(ctx context.Context, args ...any) Row {
+	ev := s.event(OpQueryRow, args)
+	return s.chain.queryRow(ctx, ev, func(ctx context.Context) Row {
+		return s.stmt.QueryRow(ctx, ev.Args...)
+	})
+}
+
+func (s *hookPreparedStatement) Name() string {
+	return s.stmt.Name()
+}
+
+//
+// ---------- Tx ----------
+//
+
+type hookTx struct {
+	tx     Tx
+	chain  hookChain
+	nested bool
+}
+
+func (t *hookTx) Exec(ctx context.Context, sql string, args ...any) (ExecResult, error) {
+	ev := &QueryEvent{Op: OpExec, SQL: sql, Args: args, InTx: true}
+	return t.chain.exec(ctx, ev, func(ctx context.Context) (ExecResult, error) {
+		return t.tx.Exec(ctx, ev.SQL, ev.Args...)
+	})
+}
+
+func (t *hookTx) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	ev := &QueryEvent{Op: OpQuery, SQL: sql, Args: args, InTx: true}
+	return t.chain.query(ctx, ev, func(ctx context.Context) (Rows, error) {
+		return t.tx.Query(ctx, ev.SQL, ev.Args...)
+	})
+}
+
+func (t *hookTx) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	ev := &QueryEvent{Op: OpQueryRow, SQL: sql, Args: args, InTx: true}
+	return t.chain.queryRow(ctx, ev, func(ctx context.Context) Row {
+		return t.tx.QueryRow(ctx, ev.SQL, ev.Args...)
+	})
+}
+
+func (t *hookTx) SendBatch(ctx context.Context, b *Batch) BatchResults {
+	ev := &QueryEvent{Op: OpBatch, Batch: b.Queries(), InTx: true}
+	return t.chain.batch(ctx, ev, func(ctx context.Context) BatchResults {
+		return t.tx.SendBatch(ctx, b)
+	})
+}
+
+func (t *hookTx) CopyFrom(ctx context.Context, table string, columns []string, src CopySource) (int64, error) {
+	return t.chain.copyFrom(ctx, &QueryEvent{InTx: true}, t.tx, table, columns, src)
+}
+
+func (t *hookTx) InsertOptions() InsertOptions {
+	return insertOptionsOf(t.tx)
+}
+
+func (t *hookTx) CopyTo(ctx context.Context, query string, w io.Writer, opts CopyOptions) (int64, error) {
+	return t.chain.copyTo(ctx, &QueryEvent{InTx: true}, t.tx, query, w, opts)
+}
+
+func (t *hookTx) Begin(ctx context.Context) (Tx, error) {
+	var tx Tx
+
+	ev := &QueryEvent{Op: OpBegin, InTx: true, Nested: true}
+	err := t.chain.run(ctx, ev, func(ctx context.Context) (err error) {
+		tx, err = t.tx.Begin(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hookTx{tx: tx, chain: t.chain, nested: true}, nil
+}
+
+func (t *hookTx) Commit(ctx context.Context) error {
+	return t.chain.run(ctx, &QueryEvent{Op: OpCommit, InTx: true, Nested: t.nested}, t.tx.Commit)
+}
+
+func (t *hookTx) Rollback(ctx context.Context) error {
+	return t.chain.run(ctx, &QueryEvent{Op: OpRollback, InTx: true, Nested: t.nested}, t.tx.Rollback)
+}
+
+//
+// ---------- Row ----------
+//
+
+type hookRow struct {
+	row   Row
+	ctx   context.Context
+	ev    *QueryEvent
+	chain hookChain
+	done  bool
+}
+
+func (r *hookRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if !r.done {
+		r.done = true
+		r.chain.after(r.ctx, r.ev, err)
+	}
+	return err
+}
+
+//
+// ---------- Batch ----------
+//
+
+type hookBatchResults struct {
+	br    BatchResults
+	ctx   context.Context
+	ev    *QueryEvent
+	chain hookChain
+	done  bool
+}
+
+func (r *hookBatchResults) Exec() (ExecResult, error) {
+	res, err := r.br.Exec()
+	if res != nil {
+		r.ev.RowsAffected += res.RowsAffected()
+	}
+	return res, err
+}
+
+func (r *hookBatchResults) Query() (Rows, error) {
+	return r.br.Query()
+}
+
+func (r *hookBatchResults) QueryRow() Row {
+	return r.br.QueryRow()
+}
+
+func (r *hookBatchResults) Close() error {
+	err := r.br.Close()
+	if !r.done {
+		r.done = true
+		r.chain.after(r.ctx, r.ev, err)
+	}
+	return err
+}
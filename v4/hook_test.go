@@ -0,0 +1,165 @@
+package ds_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+type recordingHook struct {
+	name   string
+	log    *[]string
+	events []ds.QueryEvent
+}
+
+func (h *recordingHook) Before(ctx context.Context, ev *ds.QueryEvent) context.Context {
+	*h.log = append(*h.log, h.name+".before")
+	return ctx
+}
+
+func (h *recordingHook) After(_ context.Context, ev *ds.QueryEvent) {
+	*h.log = append(*h.log, h.name+".after")
+	h.events = append(h.events, *ev)
+}
+
+func hookedConn(t *testing.T, p *dstest.Provider, hooks ...ds.Hook) ds.Conn {
+	t.Helper()
+
+	pc, id, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hpc := ds.WithHooks(pc, id, hooks...)
+	t.Cleanup(hpc.Release)
+
+	return hpc.Conn()
+}
+
+func TestWithHooksChainOrder(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`INSERT`).WithArgs("alice").WillReturnResult(1)
+
+	var log []string
+	first := &recordingHook{name: "first", log: &log}
+	second := &recordingHook{name: "second", log: &log}
+
+	conn := hookedConn(t, p, first, second)
+
+	if _, err := conn.Exec(context.Background(), "INSERT INTO users(name) VALUES($1)", "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := strings.Join(log, ",")
+	if got != "first.before,second.before,second.after,first.after" {
+		t.Fatalf("unexpected hook order: %s", got)
+	}
+
+	ev := first.events[0]
+	if ev.Op != ds.OpExec || ev.ServerID != dstest.PrimaryID || ev.RowsAffected != 1 {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	if len(ev.Args) != 1 || ev.Args[0] != "alice" {
+		t.Fatalf("unexpected args: %v", ev.Args)
+	}
+}
+
+func TestWithHooksRewritesQuery(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`^/\* app \*/ DELETE FROM users$`)
+
+	tag := ds.HookFuncs{
+		BeforeFunc: func(ctx context.Context, ev *ds.QueryEvent) context.Context {
+			ev.SQL = "/* app */ " + ev.SQL
+			return ctx
+		},
+	}
+
+	conn := hookedConn(t, p, tag)
+
+	if _, err := conn.Exec(context.Background(), "DELETE FROM users"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWithHooksTransactionAndStatements(t *testing.T) {
+	ctx := context.Background()
+	expectedErr := errors.New("no rows left")
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectPrepare("user_name", `SELECT name`)
+	p.ExpectQuery(`SELECT name`).WillReturnError(expectedErr)
+	p.ExpectBegin()
+	p.ExpectExec(`UPDATE`)
+	p.ExpectCommit()
+
+	var log []string
+	h := &recordingHook{name: "h", log: &log}
+	conn := hookedConn(t, p, h)
+
+	stmt, err := conn.Prepare(ctx, "user_name", "SELECT name FROM users WHERE id = $1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var name string
+	row := stmt.QueryRow(ctx, 1)
+	if len(h.events) != 1 {
+		t.Fatalf("QueryRow must be reported when scanned, got %d events", len(h.events))
+	}
+	if err := row.Scan(&name); !errors.Is(err, expectedErr) {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+
+	err = ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET name = $1", "bob")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		op        ds.Op
+		statement string
+		inTx      bool
+		err       error
+	}{
+		{ds.OpPrepare, "user_name", false, nil},
+		{ds.OpQueryRow, "user_name", false, expectedErr},
+		{ds.OpBegin, "", true, nil},
+		{ds.OpExec, "", true, nil},
+		{ds.OpCommit, "", true, nil},
+	}
+	if len(h.events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(h.events))
+	}
+	for i, w := range want {
+		ev := h.events[i]
+		if ev.Op != w.op || ev.Statement != w.statement || ev.InTx != w.inTx || !errors.Is(ev.Err, w.err) {
+			t.Fatalf("event %d: unexpected %+v", i, ev)
+		}
+	}
+}
+
+func TestWithHooksWithoutHooks(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+
+	pc, id, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	if ds.WithHooks(pc, id) != pc {
+		t.Fatal("expected pool connection to be returned unchanged")
+	}
+}
@@ -0,0 +1,108 @@
+package ds
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// LogOptions configures NewLogHook.
+type LogOptions struct {
+	// SlowQueryThreshold logs operations that take at least this long
+	// at warning level. Zero disables slow query records.
+	SlowQueryThreshold time.Duration
+	// LogArgs includes query arguments in records. By default only
+	// the number of arguments is logged.
+	LogArgs bool
+	// RedactArg, if set, replaces argument values before they are logged.
+	RedactArg func(index int, value any) any
+}
+
+// NewLogHook returns a Hook writing structured records to logger:
+// failed operations at error level, slow operations at warning level,
+// transaction rollbacks at info level and everything else at debug level.
+// ErrNoRows is not treated as a failure.
+func NewLogHook(logger *slog.Logger, opts LogOptions) Hook {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &logHook{logger: logger, opts: opts}
+}
+
+type logHook struct {
+	logger *slog.Logger
+	opts   LogOptions
+}
+
+func (h *logHook) Before(ctx context.Context, _ *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *logHook) After(ctx context.Context, ev *QueryEvent) {
+	level, msg := slog.LevelDebug, "ds: query"
+
+	switch {
+	case ev.Err != nil && !errors.Is(ev.Err, ErrNoRows):
+		level, msg = slog.LevelError, "ds: query failed"
+	case h.opts.SlowQueryThreshold > 0 && ev.Duration >= h.opts.SlowQueryThreshold:
+		level, msg = slog.LevelWarn, "ds: slow query"
+	case ev.Op == OpRollback:
+		level, msg = slog.LevelInfo, "ds: transaction rolled back"
+	}
+
+	if !h.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("op", string(ev.Op)),
+		slog.String("server", string(ev.ServerID)),
+		slog.Duration("duration", ev.Duration),
+	}
+	if ev.SQL != "" {
+		attrs = append(attrs, slog.String("sql", ev.SQL))
+	}
+	if ev.Statement != "" {
+		attrs = append(attrs, slog.String("statement", ev.Statement))
+	}
+	if ev.InTx {
+		attrs = append(attrs, slog.Bool("in_tx", true))
+	}
+	if ev.Nested {
+		attrs = append(attrs, slog.Bool("nested", true))
+	}
+	if len(ev.Batch) > 0 {
+		attrs = append(attrs, slog.Int("batch_size", len(ev.Batch)))
+	}
+	switch ev.Op {
+	case OpExec, OpBatch, OpCopyFrom, OpCopyTo:
+		if ev.Err == nil {
+			attrs = append(attrs, slog.Int64("rows_affected", ev.RowsAffected))
+		}
+	}
+	if len(ev.Args) > 0 {
+		attrs = append(attrs, h.argsAttr(ev.Args))
+	}
+	if ev.Err != nil {
+		attrs = append(attrs, slog.Any("error", ev.Err))
+	}
+
+	h.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (h *logHook) argsAttr(args []any) slog.Attr {
+	if !h.opts.LogArgs {
+		return slog.Int("args", len(args))
+	}
+
+	values := make([]any, len(args))
+	for i, v := range args {
+		if h.opts.RedactArg != nil {
+			v = h.opts.RedactArg(i, v)
+		}
+		values[i] = v
+	}
+	return slog.Any("args", values)
+}
@@ -0,0 +1,103 @@
+package ds_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+func logRecord(t *testing.T, opts ds.LogOptions, ev ds.QueryEvent) map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	hook := ds.NewLogHook(logger, opts)
+	ctx := hook.Before(context.Background(), &ev)
+	hook.After(ctx, &ev)
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid log record %q: %v", buf.String(), err)
+	}
+	return rec
+}
+
+func TestLogHookLevels(t *testing.T) {
+	tests := []struct {
+		name  string
+		ev    ds.QueryEvent
+		level string
+		msg   string
+	}{
+		{
+			name:  "query",
+			ev:    ds.QueryEvent{Op: ds.OpQuery, SQL: "SELECT 1", Duration: time.Millisecond},
+			level: "DEBUG",
+			msg:   "ds: query",
+		},
+		{
+			name:  "no rows is not a failure",
+			ev:    ds.QueryEvent{Op: ds.OpQueryRow, SQL: "SELECT 1", Err: ds.ErrNoRows},
+			level: "DEBUG",
+			msg:   "ds: query",
+		},
+		{
+			name:  "failure",
+			ev:    ds.QueryEvent{Op: ds.OpExec, SQL: "DELETE", Err: errors.New("boom")},
+			level: "ERROR",
+			msg:   "ds: query failed",
+		},
+		{
+			name:  "slow",
+			ev:    ds.QueryEvent{Op: ds.OpExec, SQL: "UPDATE", Duration: time.Second},
+			level: "WARN",
+			msg:   "ds: slow query",
+		},
+		{
+			name:  "rollback",
+			ev:    ds.QueryEvent{Op: ds.OpRollback, InTx: true},
+			level: "INFO",
+			msg:   "ds: transaction rolled back",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := logRecord(t, ds.LogOptions{SlowQueryThreshold: 100 * time.Millisecond}, tt.ev)
+			if rec["level"] != tt.level || rec["msg"] != tt.msg {
+				t.Fatalf("expected %s %q, got %v %q", tt.level, tt.msg, rec["level"], rec["msg"])
+			}
+		})
+	}
+}
+
+func TestLogHookArgs(t *testing.T) {
+	ev := ds.QueryEvent{Op: ds.OpExec, SQL: "INSERT", Args: []any{"alice", "secret"}}
+
+	rec := logRecord(t, ds.LogOptions{}, ev)
+	if rec["args"] != float64(2) {
+		t.Fatalf("expected argument count by default, got %v", rec["args"])
+	}
+
+	rec = logRecord(t, ds.LogOptions{
+		LogArgs: true,
+		RedactArg: func(i int, v any) any {
+			if i == 1 {
+				return "[redacted]"
+			}
+			return v
+		},
+	}, ev)
+
+	args, ok := rec["args"].([]any)
+	if !ok || len(args) != 2 || args[0] != "alice" || args[1] != "[redacted]" {
+		t.Fatalf("unexpected args: %v", rec["args"])
+	}
+}
@@ -0,0 +1,95 @@
+package ds
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidLSN = errors.New("ds: invalid LSN")
+
+// LSN is a PostgreSQL write-ahead log position. The zero value is the
+// invalid position 0/0, which every server has reached.
+//
+// LSN is written in the "X/Y" form of the pg_lsn type, where X and Y
+// are the high and low 32 bits in hexadecimal. It implements
+// encoding.TextMarshaler, so it is encoded as a JSON string,
+// and sql.Scanner / driver.Valuer.
+type LSN uint64
+
+// ParseLSN parses the "X/Y" form of an LSN.
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok || hi == "" || lo == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLSN, s)
+	}
+
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLSN, s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLSN, s)
+	}
+
+	return LSN(h<<32 | l), nil
+}
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint64(l)>>32, uint64(l)&0xFFFFFFFF)
+}
+
+// Compare returns -1, 0 or +1 if l is before, equal to or after o.
+func (l LSN) Compare(o LSN) int {
+	switch {
+	case l < o:
+		return -1
+	case l > o:
+		return 1
+	}
+	return 0
+}
+
+// Sub returns the number of WAL bytes between o and l,
+// negative if l is before o.
+func (l LSN) Sub(o LSN) int64 {
+	return int64(l - o)
+}
+
+func (l LSN) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *LSN) UnmarshalText(b []byte) error {
+	v, err := ParseLSN(string(b))
+	if err != nil {
+		return err
+	}
+
+	*l = v
+	return nil
+}
+
+// Scan implements sql.Scanner for pg_lsn and text columns.
+// NULL scans as the zero LSN.
+func (l *LSN) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*l = 0
+		return nil
+	case string:
+		return l.UnmarshalText([]byte(v))
+	case []byte:
+		return l.UnmarshalText(v)
+	}
+
+	return fmt.Errorf("ds: cannot scan %T into LSN", src)
+}
+
+// Value implements driver.Valuer.
+func (l LSN) Value() (driver.Value, error) {
+	return l.String(), nil
+}
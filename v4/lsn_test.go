@@ -0,0 +1,99 @@
+package ds_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+)
+
+func TestParseLSN(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ds.LSN
+		wantErr bool
+	}{
+		{in: "0/0", want: 0},
+		{in: "0/16B3748", want: 0x16B3748},
+		{in: "0/16b3748", want: 0x16B3748},
+		{in: "1/0", want: 1 << 32},
+		{in: "FFFFFFFF/FFFFFFFF", want: 1<<64 - 1},
+		{in: "", wantErr: true},
+		{in: "16B3748", wantErr: true},
+		{in: "0/", wantErr: true},
+		{in: "G/0", wantErr: true},
+		{in: "100000000/0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ds.ParseLSN(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ds.ErrInvalidLSN) {
+				t.Fatalf("ParseLSN(%q): expected ErrInvalidLSN, got %v", tt.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseLSN(%q): unexpected error %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseLSN(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLSNStringCompareSub(t *testing.T) {
+	a, b := ds.LSN(0x16B3748), ds.LSN(1<<32|0x10)
+
+	if a.String() != "0/16B3748" || b.String() != "1/10" {
+		t.Fatalf("unexpected strings: %s %s", a, b)
+	}
+	if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+		t.Fatal("unexpected comparison")
+	}
+	if d := b.Sub(a); d != int64(b)-int64(a) {
+		t.Fatalf("unexpected distance %d", d)
+	}
+	if d := a.Sub(b); d >= 0 {
+		t.Fatalf("expected negative distance, got %d", d)
+	}
+}
+
+func TestLSNJSONAndScan(t *testing.T) {
+	b, err := json.Marshal(struct{ LSN ds.LSN }{LSN: 0x16B3748})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != `{"LSN":"0/16B3748"}` {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+
+	var v struct{ LSN ds.LSN }
+	if err := json.Unmarshal([]byte(`{"LSN":"1/A"}`), &v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.LSN != 1<<32|0xA {
+		t.Fatalf("unexpected LSN %s", v.LSN)
+	}
+	if err := json.Unmarshal([]byte(`{"LSN":"bad"}`), &v); !errors.Is(err, ds.ErrInvalidLSN) {
+		t.Fatalf("expected ErrInvalidLSN, got %v", err)
+	}
+
+	var l ds.LSN
+	for _, src := range []any{"0/5", []byte("0/5")} {
+		if err := l.Scan(src); err != nil || l != 5 {
+			t.Fatalf("Scan(%v) = %s, %v", src, l, err)
+		}
+	}
+	if err := l.Scan(nil); err != nil || l != 0 {
+		t.Fatalf("Scan(nil) = %s, %v", l, err)
+	}
+	if err := l.Scan(42); err == nil {
+		t.Fatal("expected error scanning int")
+	}
+
+	if v, err := ds.LSN(5).Value(); err != nil || v != "0/5" {
+		t.Fatalf("Value() = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,274 @@
+package pgds
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+// Replica describes a secondary that may serve a GetSecondary call.
+type Replica struct {
+	ID ds.ServerID
+	// AcquiredConns is the number of connections currently leased
+	// from the replica pool, zero until the pool has been opened.
+	AcquiredConns int32
+}
+
+// Balancer decides the order in which GetSecondary tries replicas.
+// Implementations must be safe for concurrent use.
+type Balancer interface {
+	// Order reorders replicas in place. GetSecondary tries them in the
+	// resulting order and returns the first one that qualifies.
+	// Replicas are passed ordered by ID and exclude ejected ones.
+	Order(replicas []Replica)
+	// Observe reports how long acquiring a connection from a replica
+	// or running a health check on it took and whether it failed.
+	Observe(id ds.ServerID, latency time.Duration, err error)
+}
+
+// candidates returns the healthy secondaries in balancer order.
+func (p *Provider) candidates() []Replica {
+	replicas := make([]Replica, 0, len(p.secondaries))
+	for id, h := range p.secondaries {
+		if !p.isHealthy(id) {
+			continue
+		}
+
+		r := Replica{ID: id}
+		if s, ok := h.(interface{ acquiredConns() int32 }); ok {
+			r.AcquiredConns = s.acquiredConns()
+		}
+		replicas = append(replicas, r)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].ID < replicas[j].ID })
+
+	if p.balancer != nil && len(replicas) > 1 {
+		p.balancer.Order(replicas)
+	}
+	return replicas
+}
+
+func (p *Provider) observe(id ds.ServerID, latency time.Duration, err error) {
+	if p.balancer != nil {
+		p.balancer.Observe(id, latency, err)
+	}
+}
+
+//
+// ---------- Round robin ----------
+//
+
+// RoundRobin starts every call with the next replica in ID order.
+// It is the default balancer.
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+var _ Balancer = (*RoundRobin)(nil)
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+func (b *RoundRobin) Order(replicas []Replica) {
+	rotate(replicas, b.next.Add(1)-1)
+}
+
+func (b *RoundRobin) Observe(ds.ServerID, time.Duration, error) {}
+
+// rotate moves replicas[n%len] to the front keeping the cyclic order.
+func rotate(replicas []Replica, n uint64) {
+	k := int(n % uint64(len(replicas)))
+	if k == 0 {
+		return
+	}
+
+	rotated := append(append(make([]Replica, 0, len(replicas)), replicas[k:]...), replicas[:k]...)
+	copy(replicas, rotated)
+}
+
+//
+// ---------- Weighted ----------
+//
+
+// Weighted spreads calls in proportion to replica weights using
+// smooth weighted round robin. Replicas without a weight get 1,
+// replicas with a zero or negative weight are only tried last.
+type Weighted struct {
+	weights map[ds.ServerID]int
+
+	mu      sync.Mutex
+	current map[ds.ServerID]int
+}
+
+var _ Balancer = (*Weighted)(nil)
+
+func NewWeighted(weights map[ds.ServerID]int) *Weighted {
+	w := make(map[ds.ServerID]int, len(weights))
+	for id, v := range weights {
+		w[id] = v
+	}
+
+	return &Weighted{
+		weights: w,
+		current: make(map[ds.ServerID]int),
+	}
+}
+
+func (b *Weighted) weight(id ds.ServerID) int {
+	w, ok := b.weights[id]
+	if !ok {
+		return 1
+	}
+	return w
+}
+
+func (b *Weighted) Order(replicas []Replica) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best, total := -1, 0
+	for i, r := range replicas {
+		w := b.weight(r.ID)
+		if w <= 0 {
+			continue
+		}
+
+		b.current[r.ID] += w
+		total += w
+		if best < 0 || b.current[r.ID] > b.current[replicas[best].ID] {
+			best = i
+		}
+	}
+	var picked ds.ServerID
+	if best >= 0 {
+		picked = replicas[best].ID
+		b.current[picked] -= total
+	}
+
+	// The picked replica goes first, the others follow
+	// by descending weight as fallbacks.
+	sort.SliceStable(replicas, func(i, j int) bool {
+		pi, pj := best >= 0 && replicas[i].ID == picked, best >= 0 && replicas[j].ID == picked
+		if pi != pj {
+			return pi
+		}
+		return b.weight(replicas[i].ID) > b.weight(replicas[j].ID)
+	})
+}
+
+func (b *Weighted) Observe(ds.ServerID, time.Duration, error) {}
+
+//
+// ---------- Least in use ----------
+//
+
+// LeastInUse prefers the replica with the fewest leased connections.
+// Ties are broken in round robin order.
+type LeastInUse struct {
+	rr RoundRobin
+}
+
+var _ Balancer = (*LeastInUse)(nil)
+
+func NewLeastInUse() *LeastInUse {
+	return &LeastInUse{}
+}
+
+func (b *LeastInUse) Order(replicas []Replica) {
+	b.rr.Order(replicas)
+	sort.SliceStable(replicas, func(i, j int) bool {
+		return replicas[i].AcquiredConns < replicas[j].AcquiredConns
+	})
+}
+
+func (b *LeastInUse) Observe(ds.ServerID, time.Duration, error) {}
+
+//
+// ---------- Latency EWMA ----------
+//
+
+const (
+	defaultEWMADecay = 0.3
+	// latencyErrorPenalty is the sample recorded for a failed observation.
+	latencyErrorPenalty = time.Second
+)
+
+// LatencyEWMA prefers the replica with the lowest exponentially weighted
+// moving average of observed latencies. Replicas without observations
+// are tried first so they get measured. Ties are broken in round robin
+// order. Failures count as a one second sample.
+type LatencyEWMA struct {
+	decay float64
+	rr    RoundRobin
+
+	mu   sync.Mutex
+	ewma map[ds.ServerID]float64
+}
+
+var _ Balancer = (*LatencyEWMA)(nil)
+
+// NewLatencyEWMA returns a LatencyEWMA balancer. decay in (0, 1] is the
+// weight of a new sample, values outside the range select 0.3.
+func NewLatencyEWMA(decay float64) *LatencyEWMA {
+	if decay <= 0 || decay > 1 {
+		decay = defaultEWMADecay
+	}
+
+	return &LatencyEWMA{
+		decay: decay,
+		ewma:  make(map[ds.ServerID]float64),
+	}
+}
+
+func (b *LatencyEWMA) Order(replicas []Replica) {
+	b.rr.Order(replicas)
+
+	b.mu.Lock()
+	scores := make([]float64, len(replicas))
+	for i, r := range replicas {
+		scores[i] = b.ewma[r.ID]
+	}
+	b.mu.Unlock()
+
+	sort.Stable(byScore{replicas: replicas, scores: scores})
+}
+
+func (b *LatencyEWMA) Observe(id ds.ServerID, latency time.Duration, err error) {
+	if err != nil {
+		latency = latencyErrorPenalty
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v, ok := b.ewma[id]
+	if !ok {
+		b.ewma[id] = float64(latency)
+		return
+	}
+	b.ewma[id] = v + b.decay*(float64(latency)-v)
+}
+
+// Latency returns the current average latency of a replica.
+func (b *LatencyEWMA) Latency(id ds.ServerID) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return time.Duration(b.ewma[id])
+}
+
+type byScore struct {
+	replicas []Replica
+	scores   []float64
+}
+
+func (s byScore) Len() int           { return len(s.replicas) }
+func (s byScore) Less(i, j int) bool { return s.scores[i] < s.scores[j] }
+func (s byScore) Swap(i, j int) {
+	s.replicas[i], s.replicas[j] = s.replicas[j], s.replicas[i]
+	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+}
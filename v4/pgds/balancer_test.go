@@ -0,0 +1,138 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+func replicas(ids ...ds.ServerID) []Replica {
+	r := make([]Replica, len(ids))
+	for i, id := range ids {
+		r[i] = Replica{ID: id}
+	}
+	return r
+}
+
+func first(b Balancer, r []Replica) ds.ServerID {
+	c := append([]Replica(nil), r...)
+	b.Order(c)
+	return c[0].ID
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	b := NewRoundRobin()
+	r := replicas("r1", "r2", "r3")
+
+	var got []ds.ServerID
+	for range 4 {
+		got = append(got, first(b, r))
+	}
+
+	want := []ds.ServerID{"r1", "r2", "r3", "r1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	b := NewWeighted(map[ds.ServerID]int{"r1": 3, "r2": 1, "r3": 0})
+	r := replicas("r1", "r2", "r3")
+
+	counts := map[ds.ServerID]int{}
+	for range 8 {
+		c := append([]Replica(nil), r...)
+		b.Order(c)
+		counts[c[0].ID]++
+
+		if c[2].ID != "r3" {
+			t.Fatalf("zero weight replica must be tried last, got %v", c)
+		}
+	}
+
+	if counts["r1"] != 6 || counts["r2"] != 2 || counts["r3"] != 0 {
+		t.Fatalf("unexpected distribution: %v", counts)
+	}
+}
+
+func TestLeastInUseBalancer(t *testing.T) {
+	b := NewLeastInUse()
+	r := []Replica{
+		{ID: "r1", AcquiredConns: 5},
+		{ID: "r2", AcquiredConns: 1},
+		{ID: "r3", AcquiredConns: 3},
+	}
+
+	b.Order(r)
+	if r[0].ID != "r2" || r[1].ID != "r3" || r[2].ID != "r1" {
+		t.Fatalf("unexpected order: %v", r)
+	}
+
+	// Ties are spread.
+	idle := replicas("r1", "r2")
+	if a, c := first(b, idle), first(b, idle); a == c {
+		t.Fatalf("expected ties to alternate, got %s twice", a)
+	}
+}
+
+func TestLatencyEWMABalancer(t *testing.T) {
+	b := NewLatencyEWMA(0.5)
+	r := replicas("r1", "r2", "r3")
+
+	b.Observe("r1", 40*time.Millisecond, nil)
+	b.Observe("r2", 10*time.Millisecond, nil)
+
+	if id := first(b, r); id != "r3" {
+		t.Fatalf("expected unmeasured replica first, got %s", id)
+	}
+
+	b.Observe("r3", 20*time.Millisecond, nil)
+	if id := first(b, r); id != "r2" {
+		t.Fatalf("expected fastest replica first, got %s", id)
+	}
+
+	b.Observe("r2", 0, errors.New("acquire failed"))
+	if got := b.Latency("r2"); got != 505*time.Millisecond {
+		t.Fatalf("unexpected average after failure: %v", got)
+	}
+	if id := first(b, r); id != "r3" {
+		t.Fatalf("expected failing replica to lose priority, got %s", id)
+	}
+}
+
+func TestGetSecondaryUsesBalancer(t *testing.T) {
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": &fakeDB{},
+			"replica2": &fakeDB{},
+			"replica3": &fakeDB{acquireErr: errors.New("down")},
+		},
+		balancer: NewRoundRobin(),
+	}
+
+	ctx := context.Background()
+
+	var got []ds.ServerID
+	for range 4 {
+		pc, id, err := p.GetSecondary(ctx, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pc.Release()
+		got = append(got, id)
+	}
+
+	// replica3 is skipped in favour of the next one in order.
+	want := []ds.ServerID{"replica1", "replica2", "replica1", "replica1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
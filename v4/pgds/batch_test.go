@@ -0,0 +1,77 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/dronm/ds/v4"
+)
+
+// fakeBatchConn records the sent batch and fails every statement
+// after the first with a unique violation.
+type fakeBatchConn struct {
+	sent *pgx.Batch
+}
+
+func (c *fakeBatchConn) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	c.sent = b
+	return &fakeBatchResults{}
+}
+
+type fakeBatchResults struct {
+	read int
+}
+
+func (r *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	r.read++
+	if r.read > 1 {
+		return pgconn.CommandTag{}, &pgconn.PgError{Code: ErrCodeUniqueViolation}
+	}
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (r *fakeBatchResults) Query() (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeBatchResults) QueryRow() pgx.Row {
+	return errRow{err: errors.New("not implemented")}
+}
+
+func (r *fakeBatchResults) Close() error {
+	return &pgconn.PgError{Code: ErrCodeUniqueViolation}
+}
+
+func TestSendBatch(t *testing.T) {
+	conn := &fakeBatchConn{}
+
+	b := &ds.Batch{}
+	b.Queue("INSERT INTO users(name) VALUES($1)", "alice")
+	b.Queue("INSERT INTO users(name) VALUES($1)", "alice")
+
+	br := sendBatch(context.Background(), conn, b)
+	if conn.sent.Len() != 2 || conn.sent.QueuedQueries[1].Arguments[0] != "alice" {
+		t.Fatalf("unexpected pgx batch: %+v", conn.sent.QueuedQueries)
+	}
+
+	res, err := br.Exec()
+	if err != nil || res.RowsAffected() != 1 {
+		t.Fatalf("unexpected result: %v, %v", res, err)
+	}
+	if _, err := br.Exec(); !errors.Is(err, ds.ErrUniqueViolation) {
+		t.Fatalf("expected ErrUniqueViolation, got %v", err)
+	}
+	if err := br.QueryRow().Scan(); !errors.Is(err, ds.ErrNoBatchResults) {
+		t.Fatalf("expected ErrNoBatchResults, got %v", err)
+	}
+	if err := br.Close(); !errors.Is(err, ds.ErrUniqueViolation) {
+		t.Fatalf("expected ErrUniqueViolation, got %v", err)
+	}
+	if _, err := br.Query(); !errors.Is(err, ds.ErrBatchClosed) {
+		t.Fatalf("expected ErrBatchClosed, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/dronm/ds/v4"
+)
+
+var (
+	_ ds.Copier = (*pgConn)(nil)
+	_ ds.Copier = (*pgTx)(nil)
+)
+
+// CopyFrom writes the rows of src to table with COPY FROM STDIN
+// in the binary format.
+func (c *pgConn) CopyFrom(
+	ctx context.Context,
+	table string,
+	columns []string,
+	src ds.CopySource,
+) (int64, error) {
+	n, err := c.conn.CopyFrom(ctx, identifier(table), columns, src)
+	return n, classifyError(err)
+}
+
+// CopyTo writes the result of query to w with COPY TO STDOUT.
+func (c *pgConn) CopyTo(
+	ctx context.Context,
+	query string,
+	w io.Writer,
+	opts ds.CopyOptions,
+) (int64, error) {
+	return copyTo(ctx, c.conn.PgConn(), query, w, opts)
+}
+
+func (t *pgTx) CopyFrom(
+	ctx context.Context,
+	table string,
+	columns []string,
+	src ds.CopySource,
+) (int64, error) {
+	n, err := t.tx.CopyFrom(ctx, identifier(table), columns, src)
+	return n, classifyError(err)
+}
+
+func (t *pgTx) CopyTo(
+	ctx context.Context,
+	query string,
+	w io.Writer,
+	opts ds.CopyOptions,
+) (int64, error) {
+	return copyTo(ctx, t.tx.Conn().PgConn(), query, w, opts)
+}
+
+func identifier(table string) pgx.Identifier {
+	return pgx.Identifier(strings.Split(table, "."))
+}
+
+func copyTo(
+	ctx context.Context,
+	conn *pgconn.PgConn,
+	query string,
+	w io.Writer,
+	opts ds.CopyOptions,
+) (int64, error) {
+	sql, err := copyToSQL(query, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := conn.CopyTo(ctx, w, sql)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// copyToSQL wraps query in a COPY TO STDOUT statement.
+func copyToSQL(query string, opts ds.CopyOptions) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("COPY (")
+	sb.WriteString(query)
+	sb.WriteString(") TO STDOUT WITH (FORMAT ")
+
+	switch opts.Format {
+	case ds.CopyText, ds.CopyCSV:
+		sb.WriteString(opts.Format.String())
+	case ds.CopyBinary:
+		if opts.Header || opts.Delimiter != 0 {
+			return "", errors.New("pgds: binary COPY takes no header or delimiter")
+		}
+		sb.WriteString("binary")
+	default:
+		return "", errors.New("pgds: unknown COPY format")
+	}
+
+	if opts.Header {
+		sb.WriteString(", HEADER")
+	}
+	if opts.Delimiter != 0 {
+		sb.WriteString(", DELIMITER '")
+		sb.WriteString(strings.ReplaceAll(string(opts.Delimiter), "'", "''"))
+		sb.WriteString("'")
+	}
+	sb.WriteString(")")
+
+	return sb.String(), nil
+}
@@ -0,0 +1,78 @@
+package pgds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/dronm/ds/v4"
+)
+
+// SQLSTATE codes mapped to ds error codes. Class 08 (connection
+// exception) is mapped to ds.CodeConnectionLost as a whole.
+var sqlStateCodes = map[string]ds.ErrorCode{
+	ErrCodeUniqueViolation:      ds.CodeUniqueViolation,
+	"23503":                     ds.CodeForeignKeyViolation,
+	"23502":                     ds.CodeNotNullViolation,
+	"23514":                     ds.CodeCheckViolation,
+	ErrCodeSerializationFailure: ds.CodeSerializationFailure,
+	ErrCodeDeadlockDetected:     ds.CodeDeadlock,
+	"57014":                     ds.CodeQueryCanceled,
+	"25006":                     ds.CodeReadOnlyTransaction,
+	"57P01":                     ds.CodeConnectionLost, // admin_shutdown
+	"57P02":                     ds.CodeConnectionLost, // crash_shutdown
+	"57P03":                     ds.CodeConnectionLost, // cannot_connect_now
+}
+
+// classifyError wraps err in a *ds.Error when its class is known and
+// reports pgx.ErrTxClosed as ds.ErrTxDone. Other errors, including
+// already classified ones, are returned as is.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := ds.ErrorDetails(err); ok || errors.Is(err, ds.ErrTxDone) {
+		return err
+	}
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return fmt.Errorf("%w: %w", ds.ErrTxDone, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		code, ok := sqlStateCodes[pgErr.Code]
+		if !ok && strings.HasPrefix(pgErr.Code, "08") {
+			code, ok = ds.CodeConnectionLost, true
+		}
+		if !ok {
+			return err
+		}
+
+		return &ds.Error{
+			Code:       code,
+			DriverCode: pgErr.Code,
+			Constraint: pgErr.ConstraintName,
+			Table:      pgErr.TableName,
+			Column:     pgErr.ColumnName,
+			Err:        err,
+		}
+	}
+
+	var connectErr *pgconn.ConnectError
+	switch {
+	case errors.As(err, &connectErr),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed):
+		return &ds.Error{Code: ds.CodeConnectionLost, Err: err}
+	case pgconn.Timeout(err):
+		return &ds.Error{Code: ds.CodeQueryCanceled, Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,92 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/dronm/ds/v4"
+)
+
+func TestClassifyError(t *testing.T) {
+	pgErr := &pgconn.PgError{
+		Code:           "23503",
+		ConstraintName: "orders_user_id_fkey",
+		TableName:      "orders",
+		ColumnName:     "user_id",
+	}
+
+	err := classifyError(fmt.Errorf("insert: %w", pgErr))
+	if !errors.Is(err, ds.ErrForeignKeyViolation) {
+		t.Fatalf("expected ErrForeignKeyViolation, got %v", err)
+	}
+
+	details, ok := ds.ErrorDetails(err)
+	if !ok {
+		t.Fatal("expected details")
+	}
+	if details.DriverCode != "23503" || details.Constraint != "orders_user_id_fkey" ||
+		details.Table != "orders" || details.Column != "user_id" {
+		t.Fatalf("unexpected details: %+v", details)
+	}
+
+	// Driver checks keep working.
+	var target *pgconn.PgError
+	if !errors.As(err, &target) || target != pgErr {
+		t.Fatal("expected the PgError to be unwrapped")
+	}
+	if classifyError(err) != err {
+		t.Fatal("expected classified errors to be returned as is")
+	}
+}
+
+func TestClassifyErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{&pgconn.PgError{Code: ErrCodeUniqueViolation}, ds.ErrUniqueViolation},
+		{&pgconn.PgError{Code: "23502"}, ds.ErrNotNullViolation},
+		{&pgconn.PgError{Code: "23514"}, ds.ErrCheckViolation},
+		{&pgconn.PgError{Code: ErrCodeSerializationFailure}, ds.ErrSerializationFailure},
+		{&pgconn.PgError{Code: ErrCodeDeadlockDetected}, ds.ErrDeadlock},
+		{&pgconn.PgError{Code: "57014"}, ds.ErrQueryCanceled},
+		{&pgconn.PgError{Code: "25006"}, ds.ErrReadOnlyTransaction},
+		{&pgconn.PgError{Code: "08006"}, ds.ErrConnectionLost},
+		{&pgconn.PgError{Code: "57P01"}, ds.ErrConnectionLost},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), ds.ErrConnectionLost},
+	}
+
+	for _, tt := range tests {
+		if err := classifyError(tt.err); !errors.Is(err, tt.want) {
+			t.Fatalf("classifyError(%v) = %v, expected %v", tt.err, err, tt.want)
+		}
+	}
+}
+
+func TestClassifyErrorTxClosed(t *testing.T) {
+	err := classifyError(pgx.ErrTxClosed)
+	if !errors.Is(err, ds.ErrTxDone) || !errors.Is(err, pgx.ErrTxClosed) {
+		t.Fatalf("expected ds.ErrTxDone wrapping pgx.ErrTxClosed, got %v", err)
+	}
+	if again := classifyError(err); again != err {
+		t.Fatalf("expected a classified error unchanged, got %v", again)
+	}
+}
+
+func TestClassifyErrorLeavesOthers(t *testing.T) {
+	for _, err := range []error{
+		nil,
+		context.Canceled,
+		&pgconn.PgError{Code: "42P01"},
+	} {
+		if got := classifyError(err); got != err {
+			t.Fatalf("classifyError(%v) = %v, expected it unchanged", err, got)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package pgds
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = time.Second
+	defaultFailureThreshold    = 3
+	defaultSuccessThreshold    = 2
+
+	healthCheckQuery = `SELECT 1`
+)
+
+// HealthCheckConfig configures background health checks of secondaries.
+// Zero fields take default values.
+type HealthCheckConfig struct {
+	// Interval between checks of one replica, 5s by default.
+	Interval time.Duration
+	// Timeout of a single check, 1s by default.
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failed checks
+	// after which a replica is ejected, 3 by default.
+	FailureThreshold int
+	// SuccessThreshold is the number of consecutive successful checks
+	// after which an ejected replica is re-admitted, 2 by default.
+	SuccessThreshold int
+	// OnStateChange, if set, is called from the checker goroutine when
+	// a replica is ejected or re-admitted. err is the last check error.
+	OnStateChange func(id ds.ServerID, healthy bool, err error)
+}
+
+func (c HealthCheckConfig) withDefaults() HealthCheckConfig {
+	if c.Interval <= 0 {
+		c.Interval = defaultHealthCheckInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultHealthCheckTimeout
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.SuccessThreshold <= 0 {
+		c.SuccessThreshold = defaultSuccessThreshold
+	}
+	return c
+}
+
+// healthChecker runs one checker goroutine per secondary.
+type healthChecker struct {
+	cfg     HealthCheckConfig
+	logger  *slog.Logger
+	observe func(id ds.ServerID, latency time.Duration, err error)
+	states  map[ds.ServerID]*replicaHealth
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// replicaHealth holds the state of one replica. Counters are only
+// touched by the checker goroutine, healthy is read by routing.
+type replicaHealth struct {
+	healthy   atomic.Bool
+	failures  int
+	successes int
+}
+
+// startHealthChecks starts checking every secondary of p.
+// Replicas are considered healthy until proven otherwise.
+func (p *Provider) startHealthChecks(cfg HealthCheckConfig) {
+	if len(p.secondaries) == 0 {
+		return
+	}
+
+	hc := &healthChecker{
+		cfg:     cfg.withDefaults(),
+		logger:  p.log(),
+		observe: p.observe,
+		states:  make(map[ds.ServerID]*replicaHealth, len(p.secondaries)),
+		stop:    make(chan struct{}),
+	}
+
+	for id := range p.secondaries {
+		st := &replicaHealth{}
+		st.healthy.Store(true)
+		hc.states[id] = st
+	}
+
+	for id, d := range p.secondaries {
+		hc.wg.Add(1)
+		go hc.run(id, d, hc.states[id])
+	}
+
+	p.health = hc
+}
+
+// isHealthy reports whether the replica may receive reads.
+func (p *Provider) isHealthy(id ds.ServerID) bool {
+	if p.health == nil {
+		return true
+	}
+
+	st, ok := p.health.states[id]
+	return !ok || st.healthy.Load()
+}
+
+func (hc *healthChecker) close() {
+	close(hc.stop)
+	hc.wg.Wait()
+}
+
+func (hc *healthChecker) run(id ds.ServerID, d dbHandle, st *replicaHealth) {
+	defer hc.wg.Done()
+
+	ticker := time.NewTicker(hc.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hc.stop:
+			return
+		case <-ticker.C:
+			start := time.Now()
+			err := hc.check(d)
+			hc.observe(id, time.Since(start), err)
+			hc.record(id, st, err)
+		}
+	}
+}
+
+func (hc *healthChecker) check(d dbHandle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.cfg.Timeout)
+	defer cancel()
+
+	// Stop a check in flight when the provider is closed.
+	go func() {
+		select {
+		case <-hc.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pc, err := d.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer pc.Release()
+
+	_, err = pc.Conn().Exec(ctx, healthCheckQuery)
+	return err
+}
+
+func (hc *healthChecker) record(id ds.ServerID, st *replicaHealth, err error) {
+	if err != nil {
+		st.successes = 0
+		st.failures++
+
+		if st.healthy.Load() && st.failures >= hc.cfg.FailureThreshold {
+			st.healthy.Store(false)
+			hc.logger.Warn("pgds: replica ejected",
+				slog.String("server", string(id)),
+				slog.Int("failures", st.failures),
+				slog.Any("error", err),
+			)
+			hc.notify(id, false, err)
+		}
+		return
+	}
+
+	st.failures = 0
+	st.successes++
+
+	if !st.healthy.Load() && st.successes >= hc.cfg.SuccessThreshold {
+		st.healthy.Store(true)
+		hc.logger.Info("pgds: replica re-admitted",
+			slog.String("server", string(id)),
+		)
+		hc.notify(id, true, nil)
+	}
+}
+
+func (hc *healthChecker) notify(id ds.ServerID, healthy bool, err error) {
+	if hc.cfg.OnStateChange != nil {
+		hc.cfg.OnStateChange(id, healthy, err)
+	}
+}
@@ -0,0 +1,146 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+// switchDB is a dbHandle whose availability can be changed
+// while the health checker is running.
+type switchDB struct {
+	mu   sync.Mutex
+	down bool
+}
+
+func (d *switchDB) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.down = down
+}
+
+func (d *switchDB) acquire(context.Context) (ds.PoolConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.down {
+		return nil, errors.New("replica is down")
+	}
+	return &fakePoolConn{}, nil
+}
+
+func (d *switchDB) close() error { return nil }
+
+type stateChange struct {
+	id      ds.ServerID
+	healthy bool
+}
+
+func waitStateChange(t *testing.T, changes <-chan stateChange) stateChange {
+	t.Helper()
+
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for health state change")
+		return stateChange{}
+	}
+}
+
+func TestHealthCheckEjectsAndReadmitsReplica(t *testing.T) {
+	replica := &switchDB{}
+	changes := make(chan stateChange, 4)
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": replica,
+		},
+	}
+	p.startHealthChecks(HealthCheckConfig{
+		Interval:         5 * time.Millisecond,
+		FailureThreshold: 2,
+		SuccessThreshold: 2,
+		OnStateChange: func(id ds.ServerID, healthy bool, _ error) {
+			changes <- stateChange{id: id, healthy: healthy}
+		},
+	})
+	defer p.Close()
+
+	ctx := context.Background()
+
+	_, id, err := p.GetSecondary(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "replica1" {
+		t.Fatalf("expected replica1 while healthy, got %s", id)
+	}
+
+	replica.setDown(true)
+	if c := waitStateChange(t, changes); c.id != "replica1" || c.healthy {
+		t.Fatalf("expected replica1 ejection, got %+v", c)
+	}
+
+	_, id, err = p.GetSecondary(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != PrimaryID {
+		t.Fatalf("expected fallback to primary while ejected, got %s", id)
+	}
+
+	replica.setDown(false)
+	if c := waitStateChange(t, changes); c.id != "replica1" || !c.healthy {
+		t.Fatalf("expected replica1 re-admission, got %+v", c)
+	}
+
+	_, id, err = p.GetSecondary(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "replica1" {
+		t.Fatalf("expected replica1 after recovery, got %s", id)
+	}
+}
+
+func TestHealthCheckThresholds(t *testing.T) {
+	hc := &healthChecker{
+		cfg:    HealthCheckConfig{FailureThreshold: 3, SuccessThreshold: 2}.withDefaults(),
+		logger: discardLogger,
+	}
+	st := &replicaHealth{}
+	st.healthy.Store(true)
+
+	checkErr := errors.New("timeout")
+
+	hc.record("replica1", st, checkErr)
+	hc.record("replica1", st, checkErr)
+	hc.record("replica1", st, nil)
+	hc.record("replica1", st, checkErr)
+	hc.record("replica1", st, checkErr)
+	if !st.healthy.Load() {
+		t.Fatal("a success must reset the failure count")
+	}
+
+	hc.record("replica1", st, checkErr)
+	if st.healthy.Load() {
+		t.Fatal("expected ejection after 3 consecutive failures")
+	}
+
+	hc.record("replica1", st, nil)
+	if st.healthy.Load() {
+		t.Fatal("expected replica to stay ejected after 1 success")
+	}
+
+	hc.record("replica1", st, nil)
+	if !st.healthy.Load() {
+		t.Fatal("expected re-admission after 2 consecutive successes")
+	}
+}
@@ -0,0 +1,420 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrListenerClosed = errors.New("pgds: listener is closed")
+
+const (
+	defaultListenerMinBackoff = 100 * time.Millisecond
+	defaultListenerMaxBackoff = 10 * time.Second
+	defaultListenerBuffer     = 64
+	listenerCloseTimeout      = time.Second
+)
+
+// Notification is a message received on a LISTEN channel.
+type Notification struct {
+	Channel string
+	Payload string
+	// PID is the process ID of the notifying backend.
+	PID uint32
+}
+
+// ListenerConfig configures a Listener. Zero fields take defaults.
+type ListenerConfig struct {
+	// ConnStr is the server to listen on.
+	// Provider.NewListener defaults it to the primary.
+	ConnStr string
+	// MinBackoff is the delay before the first reconnect attempt.
+	// It doubles with every failed attempt up to MaxBackoff.
+	// Defaults 100ms and 10s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// BufferSize is the capacity of each subscription channel.
+	// Default 64.
+	BufferSize int
+	// Logger receives records about lost connections and reconnects.
+	// Nil disables logging.
+	Logger *slog.Logger
+}
+
+func (c ListenerConfig) withDefaults() ListenerConfig {
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = defaultListenerMinBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultListenerMaxBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = c.MinBackoff
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = defaultListenerBuffer
+	}
+	if c.Logger == nil {
+		c.Logger = discardLogger
+	}
+	return c
+}
+
+// Listener receives LISTEN/NOTIFY notifications on a dedicated
+// connection, independent of the pools. It reconnects with backoff
+// when the connection is lost and issues LISTEN again for every
+// subscribed channel; subscribers are told through Missed that
+// notifications sent in between were lost.
+type Listener struct {
+	cfg    ListenerConfig
+	config *pgx.ConnConfig
+
+	mu        sync.Mutex
+	subs      map[string]map[*Subscription]struct{}
+	dirty     bool
+	interrupt context.CancelFunc
+	closed    bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewListener starts a Listener connected to cfg.ConnStr.
+func NewListener(cfg ListenerConfig) (*Listener, error) {
+	if cfg.ConnStr == "" {
+		return nil, errors.New("pgds: ListenerConfig.ConnStr is required")
+	}
+
+	config, err := pgx.ParseConfig(cfg.ConnStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Listener{
+		cfg:    cfg.withDefaults(),
+		config: config,
+		subs:   make(map[string]map[*Subscription]struct{}),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	config.OnNotification = func(_ *pgconn.PgConn, n *pgconn.Notification) {
+		l.dispatch(Notification{Channel: n.Channel, Payload: n.Payload, PID: n.PID})
+	}
+
+	go l.run(ctx)
+
+	return l, nil
+}
+
+// NewListener starts a Listener on the primary server.
+func (p *Provider) NewListener(cfg ListenerConfig) (*Listener, error) {
+	if cfg.ConnStr == "" {
+		cfg.ConnStr = p.primaryConnStr
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = p.logger
+	}
+	return NewListener(cfg)
+}
+
+// Subscribe listens on channel and returns once the server has
+// acknowledged LISTEN, so every notification sent afterwards is
+// delivered. If ctx is done first, the subscription is dropped and
+// the context error returned.
+func (l *Listener) Subscribe(ctx context.Context, channel string) (*Subscription, error) {
+	s := &Subscription{
+		l:       l,
+		channel: channel,
+		c:       make(chan Notification, l.cfg.BufferSize),
+		missed:  make(chan struct{}, 1),
+		ready:   make(chan struct{}),
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, ErrListenerClosed
+	}
+	if l.subs[channel] == nil {
+		l.subs[channel] = make(map[*Subscription]struct{})
+	}
+	l.subs[channel][s] = struct{}{}
+	l.changed()
+	l.mu.Unlock()
+
+	select {
+	case <-s.ready:
+		return s, nil
+	case <-l.done:
+		s.Close()
+		return nil, ErrListenerClosed
+	case <-ctx.Done():
+		s.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the listener and closes all subscriptions.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	l.cancel()
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, subs := range l.subs {
+		for s := range subs {
+			close(s.c)
+		}
+	}
+	l.subs = nil
+
+	return nil
+}
+
+// changed asks the connection loop to update its LISTEN set.
+// l.mu must be held.
+func (l *Listener) changed() {
+	l.dirty = true
+	if l.interrupt != nil {
+		l.interrupt()
+	}
+}
+
+// dispatch delivers n to the subscribers of its channel. A subscriber
+// whose buffer is full misses n and is signalled through Missed.
+func (l *Listener) dispatch(n Notification) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for s := range l.subs[n.Channel] {
+		select {
+		case s.c <- n:
+		default:
+			s.signalMissed()
+		}
+	}
+}
+
+func (l *Listener) signalMissed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, subs := range l.subs {
+		for s := range subs {
+			s.signalMissed()
+		}
+	}
+}
+
+// run keeps a connection open until ctx is done.
+func (l *Listener) run(ctx context.Context) {
+	defer close(l.done)
+
+	backoff := l.cfg.MinBackoff
+	reconnect := false
+
+	for {
+		conn, err := pgx.ConnectConfig(ctx, l.config)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			l.cfg.Logger.WarnContext(ctx, "pgds: listener connect failed",
+				slog.Duration("retry_in", backoff),
+				slog.Any("error", err),
+			)
+			if !sleepWithContext(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, l.cfg.MaxBackoff)
+			continue
+		}
+		backoff = l.cfg.MinBackoff
+
+		if reconnect {
+			l.cfg.Logger.InfoContext(ctx, "pgds: listener reconnected")
+		}
+
+		err = l.listen(ctx, conn, reconnect)
+
+		closeCtx, cancel := context.WithTimeout(context.Background(), listenerCloseTimeout)
+		_ = conn.Close(closeCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		l.cfg.Logger.WarnContext(ctx, "pgds: listener connection lost",
+			slog.Any("error", err),
+		)
+		reconnect = true
+	}
+}
+
+// listen issues LISTEN for the subscribed channels and waits for
+// notifications until the connection fails or ctx is done.
+func (l *Listener) listen(ctx context.Context, conn *pgx.Conn, reconnect bool) error {
+	listening := make(map[string]bool)
+
+	for {
+		if err := l.sync(ctx, conn, listening); err != nil {
+			return err
+		}
+		if reconnect {
+			// Notifications sent while disconnected are lost.
+			l.signalMissed()
+			reconnect = false
+		}
+
+		waitCtx, cancel := context.WithCancel(ctx)
+
+		l.mu.Lock()
+		if l.dirty {
+			l.mu.Unlock()
+			cancel()
+			continue
+		}
+		l.interrupt = cancel
+		l.mu.Unlock()
+
+		err := conn.PgConn().WaitForNotification(waitCtx)
+
+		l.mu.Lock()
+		l.interrupt = nil
+		l.mu.Unlock()
+		cancel()
+
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case waitCtx.Err() != nil && !conn.IsClosed():
+			// Interrupted to update the LISTEN set.
+		default:
+			return err
+		}
+	}
+}
+
+// sync brings the LISTEN set of conn in line with the subscriptions
+// and marks the subscriptions of listened channels ready.
+func (l *Listener) sync(ctx context.Context, conn *pgx.Conn, listening map[string]bool) error {
+	l.mu.Lock()
+	l.dirty = false
+	want := make(map[string]bool, len(l.subs))
+	for channel := range l.subs {
+		want[channel] = true
+	}
+	l.mu.Unlock()
+
+	for channel := range want {
+		if listening[channel] {
+			continue
+		}
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+		listening[channel] = true
+	}
+	for channel := range listening {
+		if want[channel] {
+			continue
+		}
+		if _, err := conn.Exec(ctx, "UNLISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+		delete(listening, channel)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for channel := range listening {
+		for s := range l.subs[channel] {
+			s.markReady()
+		}
+	}
+
+	return nil
+}
+
+// Subscription delivers the notifications of one channel.
+type Subscription struct {
+	l       *Listener
+	channel string
+	c       chan Notification
+	missed  chan struct{}
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	closeOnce sync.Once
+}
+
+// Channel returns the subscribed channel name.
+func (s *Subscription) Channel() string {
+	return s.channel
+}
+
+// C returns the channel notifications are delivered on. It is closed
+// when the subscription or the listener is closed.
+func (s *Subscription) C() <-chan Notification {
+	return s.c
+}
+
+// Missed receives a value when notifications may have been lost,
+// because the connection was re-established or C was full.
+// Consumers should resynchronize their state from the database.
+func (s *Subscription) Missed() <-chan struct{} {
+	return s.missed
+}
+
+// Close stops the subscription. The listener stops listening on the
+// channel once it has no subscriptions left.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		l := s.l
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		subs, ok := l.subs[s.channel]
+		if !ok {
+			return
+		}
+		if _, ok := subs[s]; !ok {
+			return
+		}
+
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(l.subs, s.channel)
+			l.changed()
+		}
+		close(s.c)
+	})
+}
+
+func (s *Subscription) signalMissed() {
+	select {
+	case s.missed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) markReady() {
+	s.readyOnce.Do(func() { close(s.ready) })
+}
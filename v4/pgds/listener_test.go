@@ -0,0 +1,185 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// unreachableConnStr points at a port nothing listens on.
+const unreachableConnStr = "postgres://ds@127.0.0.1:1/ds?connect_timeout=1"
+
+func TestNewListenerValidatesConfig(t *testing.T) {
+	if _, err := NewListener(ListenerConfig{}); err == nil {
+		t.Fatal("expected error for missing ConnStr")
+	}
+	if _, err := NewListener(ListenerConfig{ConnStr: "postgres://:badport"}); err == nil {
+		t.Fatal("expected error for malformed ConnStr")
+	}
+}
+
+func TestListenerSubscribeWhileDisconnected(t *testing.T) {
+	l, err := NewListener(ListenerConfig{
+		ConnStr:    unreachableConnStr,
+		MinBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewListener() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.Subscribe(ctx, "events"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	l.mu.Lock()
+	n := len(l.subs)
+	l.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected the failed subscription to be dropped, got %d channels", n)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if _, err := l.Subscribe(context.Background(), "events"); !errors.Is(err, ErrListenerClosed) {
+		t.Fatalf("expected ErrListenerClosed, got %v", err)
+	}
+}
+
+// subscribe registers a subscription on l without a running connection.
+func subscribe(l *Listener, channel string) *Subscription {
+	s := &Subscription{
+		l:       l,
+		channel: channel,
+		c:       make(chan Notification, l.cfg.BufferSize),
+		missed:  make(chan struct{}, 1),
+		ready:   make(chan struct{}),
+	}
+	if l.subs[channel] == nil {
+		l.subs[channel] = make(map[*Subscription]struct{})
+	}
+	l.subs[channel][s] = struct{}{}
+	return s
+}
+
+func TestListenerDispatch(t *testing.T) {
+	l := &Listener{
+		cfg:  ListenerConfig{BufferSize: 1}.withDefaults(),
+		subs: make(map[string]map[*Subscription]struct{}),
+	}
+	orders := subscribe(l, "orders")
+	users := subscribe(l, "users")
+
+	l.dispatch(Notification{Channel: "orders", Payload: "1"})
+	l.dispatch(Notification{Channel: "orders", Payload: "2"})
+
+	if n := <-orders.C(); n.Payload != "1" {
+		t.Fatalf("expected payload 1, got %q", n.Payload)
+	}
+	select {
+	case <-orders.Missed():
+	default:
+		t.Fatal("expected a missed signal for the full buffer")
+	}
+	select {
+	case n := <-users.C():
+		t.Fatalf("unexpected notification %+v", n)
+	default:
+	}
+
+	// A reconnect signals every subscription once.
+	l.signalMissed()
+	l.signalMissed()
+	<-users.Missed()
+	select {
+	case <-users.Missed():
+		t.Fatal("expected missed signals to coalesce")
+	default:
+	}
+
+	users.Close()
+	users.Close()
+	if _, ok := <-users.C(); ok {
+		t.Fatal("expected a closed channel")
+	}
+	if _, ok := l.subs["users"]; ok || !l.dirty {
+		t.Fatal("expected the channel to be unlistened")
+	}
+}
+
+func TestListener(t *testing.T) {
+	connStr := os.Getenv(ENV_PG_CONN)
+	if connStr == "" {
+		t.Skipf("%s environment variable is not set", ENV_PG_CONN)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := New(&Config{PrimaryConnStr: connStr})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer provider.Close()
+	p := provider.(*Provider)
+
+	l, err := p.NewListener(ListenerConfig{MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewListener() failed: %v", err)
+	}
+	defer l.Close()
+
+	sub, err := l.Subscribe(ctx, "ds_listener_test")
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	notify := func(payload string) {
+		t.Helper()
+
+		pc, _, err := p.GetPrimary(ctx)
+		if err != nil {
+			t.Fatalf("GetPrimary() failed: %v", err)
+		}
+		defer pc.Release()
+
+		if _, err := pc.Conn().Exec(ctx, "SELECT pg_notify('ds_listener_test', $1)", payload); err != nil {
+			t.Fatalf("pg_notify failed: %v", err)
+		}
+	}
+
+	notify("before")
+	if n := <-sub.C(); n.Payload != "before" {
+		t.Fatalf("expected payload before, got %q", n.Payload)
+	}
+
+	// Terminate the listening backend and expect a reconnect.
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	_, err = pc.Conn().Exec(ctx, `
+SELECT pg_terminate_backend(pid)
+FROM pg_stat_activity
+WHERE pid <> pg_backend_pid() AND query LIKE 'LISTEN %ds_listener_test%'`)
+	pc.Release()
+	if err != nil {
+		t.Fatalf("pg_terminate_backend failed: %v", err)
+	}
+
+	select {
+	case <-sub.Missed():
+	case <-ctx.Done():
+		t.Fatal("expected a missed signal after reconnect")
+	}
+
+	notify("after")
+	if n := <-sub.C(); n.Payload != "after" {
+		t.Fatalf("expected payload after, got %q", n.Payload)
+	}
+}
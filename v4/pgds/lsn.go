@@ -0,0 +1,340 @@
+package pgds
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+// replicaStateQuery returns the last replayed LSN of a standby and the
+// age of the last replayed transaction in seconds, 0 if all received WAL
+// is replayed and -1 if unknown. Lag is unknown while the WAL receiver is
+// not streaming, as the standby may be cut off from the primary with all
+// WAL it got replayed. Roles without pg_read_all_stats see no receiver
+// status, so a running receiver is then taken as streaming. A server not
+// in recovery reports its current WAL position and no lag.
+const replicaStateQuery = `
+SELECT
+	(CASE WHEN pg_is_in_recovery()
+		THEN pg_last_wal_replay_lsn()
+		ELSE pg_current_wal_lsn()
+	END)::text,
+	(CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN NOT EXISTS (
+			SELECT 1 FROM pg_stat_wal_receiver
+			WHERE coalesce(status, 'streaming') = 'streaming'
+		) THEN -1
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), -1)
+	END)::float8
+`
+
+const primaryLSNQuery = `SELECT pg_current_wal_lsn()::text`
+
+const lsnCheckTimeout = time.Second
+
+var (
+	replicaStateFn = queryReplicaState
+	primaryLSNFn   = queryPrimaryLSN
+)
+
+// replicaState is the replication position of a secondary.
+type replicaState struct {
+	lsn ds.LSN
+	// lag is the replay delay, negative if unknown.
+	lag time.Duration
+	// checked is when the tracker recorded the state.
+	checked time.Time
+}
+
+func queryReplicaState(ctx context.Context, conn ds.Conn) (replicaState, error) {
+	var (
+		st  replicaState
+		lag float64
+	)
+	if err := conn.QueryRow(ctx, replicaStateQuery).Scan(&st.lsn, &lag); err != nil {
+		return replicaState{}, err
+	}
+
+	st.lag = time.Duration(lag * float64(time.Second))
+	if lag < 0 {
+		st.lag = -1
+	}
+	return st, nil
+}
+
+func queryPrimaryLSN(ctx context.Context, conn ds.Conn) (ds.LSN, error) {
+	var lsn ds.LSN
+	err := conn.QueryRow(ctx, primaryLSNQuery).Scan(&lsn)
+	return lsn, err
+}
+
+// withinBounds reports whether a secondary in state st satisfies the
+// staleness bounds of opts given the primary position.
+func withinBounds(st replicaState, primary ds.LSN, primaryKnown bool, opts ds.ReadOptions) bool {
+	if opts.MaxLagBytes > 0 {
+		if !primaryKnown || primary.Sub(st.lsn) > opts.MaxLagBytes {
+			return false
+		}
+	}
+	if opts.MaxLag > 0 {
+		if st.lag < 0 || st.lag > opts.MaxLag {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// ---------- LSN tracker ----------
+//
+
+// lsnTracker polls the replication state of every secondary in the
+// background so GetSecondary can route by LSN and lag without extra
+// round trips. The WAL position of the primary is polled too once
+// trackPrimary is called for a MaxLagBytes bound.
+type lsnTracker struct {
+	interval time.Duration
+	logger   *slog.Logger
+	stats    *routingStats
+
+	mu             sync.Mutex
+	states         map[ds.ServerID]replicaState
+	primary        ds.LSN
+	primaryKnown   bool
+	primaryChecked time.Time
+	primaryPolled  bool
+	failing        map[ds.ServerID]bool
+	advanced       chan struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startLSNTracker starts polling every secondary of p.
+func (p *Provider) startLSNTracker(interval time.Duration) {
+	if len(p.secondaries) == 0 {
+		return
+	}
+
+	t := &lsnTracker{
+		interval: interval,
+		logger:   p.log(),
+		stats:    &p.stats,
+		states:   make(map[ds.ServerID]replicaState, len(p.secondaries)),
+		failing:  make(map[ds.ServerID]bool),
+		advanced: make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+
+	for id, d := range p.secondaries {
+		t.wg.Add(1)
+		go t.run(func(ctx context.Context) {
+			st, err := t.fetch(ctx, d)
+			t.record(id, st, err)
+		})
+	}
+
+	p.lsn = t
+}
+
+func (t *lsnTracker) close() {
+	t.mu.Lock()
+	close(t.stop)
+	t.mu.Unlock()
+
+	t.wg.Wait()
+}
+
+// trackPrimary starts polling the WAL position of d on first use and
+// reports whether a current position is known.
+func (t *lsnTracker) trackPrimary(d dbHandle) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.primaryPolled && !t.stopped() {
+		t.primaryPolled = true
+		t.wg.Add(1)
+		go t.run(func(ctx context.Context) {
+			lsn, err := t.fetchPrimary(ctx, d)
+			t.recordPrimary(lsn, err)
+		})
+	}
+
+	_, ok := t.primaryPosition()
+	return ok
+}
+
+// reached reports whether the replica has replayed target
+// as of the last poll.
+func (t *lsnTracker) reached(id ds.ServerID, target ds.LSN) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.state(id)
+	return ok && st.lsn >= target
+}
+
+// withinBounds reports whether the replica satisfied the staleness
+// bounds of opts as of the last poll.
+func (t *lsnTracker) withinBounds(id ds.ServerID, opts ds.ReadOptions) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.state(id)
+	if !ok {
+		return false
+	}
+	primary, primaryKnown := t.primaryPosition()
+	return withinBounds(st, primary, primaryKnown, opts)
+}
+
+// primaryPosition returns the last primary WAL position unless it is
+// older than a poll interval plus the check timeout. t.mu must be held.
+func (t *lsnTracker) primaryPosition() (ds.LSN, bool) {
+	if !t.primaryKnown || time.Since(t.primaryChecked) > t.interval+lsnCheckTimeout {
+		return 0, false
+	}
+	return t.primary, true
+}
+
+// state returns the last state of the replica unless it is older than
+// a poll interval plus the check timeout, which means the replica has
+// not been checked successfully since. t.mu must be held.
+func (t *lsnTracker) state(id ds.ServerID) (replicaState, bool) {
+	st, ok := t.states[id]
+	if !ok || time.Since(st.checked) > t.interval+lsnCheckTimeout {
+		return replicaState{}, false
+	}
+	return st, true
+}
+
+// changed returns a channel closed when any replica LSN advances.
+// It must be taken before checking reached to not miss an update.
+func (t *lsnTracker) changed() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.advanced
+}
+
+func (t *lsnTracker) run(poll func(ctx context.Context)) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		t.poll(poll)
+
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *lsnTracker) poll(poll func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), lsnCheckTimeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-t.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	poll(ctx)
+}
+
+func (t *lsnTracker) fetch(ctx context.Context, d dbHandle) (replicaState, error) {
+	pc, err := d.acquire(ctx)
+	if err != nil {
+		return replicaState{}, err
+	}
+	defer pc.Release()
+
+	return replicaStateFn(ctx, pc.Conn())
+}
+
+func (t *lsnTracker) fetchPrimary(ctx context.Context, d dbHandle) (ds.LSN, error) {
+	pc, err := d.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Release()
+
+	return primaryLSNFn(ctx, pc.Conn())
+}
+
+func (t *lsnTracker) stopped() bool {
+	select {
+	case <-t.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *lsnTracker) recordPrimary(lsn ds.LSN, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		if !t.stopped() {
+			// A stale primary position would understate lag.
+			t.primaryKnown = false
+			t.logger.Debug("pgds: primary LSN check failed", slog.Any("error", err))
+		}
+		return
+	}
+
+	t.primary, t.primaryKnown, t.primaryChecked = lsn, true, time.Now()
+}
+
+func (t *lsnTracker) record(id ds.ServerID, st replicaState, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		if t.stopped() {
+			return
+		}
+
+		// The replica may be down or cut off from the primary;
+		// its last position no longer qualifies it for reads.
+		delete(t.states, id)
+		t.stats.server(id).replicaCheckErrors.Add(1)
+		if !t.failing[id] {
+			t.failing[id] = true
+			t.logger.Warn("pgds: replica LSN check failed",
+				slog.String("server", string(id)),
+				slog.Any("error", err),
+			)
+		}
+		return
+	}
+
+	if t.failing[id] {
+		delete(t.failing, id)
+		t.logger.Info("pgds: replica LSN check recovered",
+			slog.String("server", string(id)),
+		)
+	}
+
+	st.checked = time.Now()
+	prev, ok := t.states[id]
+	t.states[id] = st
+
+	if !ok || st.lsn > prev.lsn {
+		close(t.advanced)
+		t.advanced = make(chan struct{})
+	}
+}
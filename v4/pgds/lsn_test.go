@@ -0,0 +1,428 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+// lsnConn reports the replication state of a fake server.
+type lsnConn struct {
+	fakeConn
+	db *lsnDB
+}
+
+type lsnDB struct {
+	lsn  atomic.Uint64
+	lag  atomic.Int64
+	fail atomic.Bool
+}
+
+func (d *lsnDB) acquire(context.Context) (ds.PoolConn, error) {
+	return &fakePoolConn{conn: &lsnConn{db: d}}, nil
+}
+
+func (d *lsnDB) close() error { return nil }
+
+func stubReplayLSN(t *testing.T) {
+	t.Helper()
+
+	origState, origPrimary := replicaStateFn, primaryLSNFn
+	t.Cleanup(func() {
+		replicaStateFn, primaryLSNFn = origState, origPrimary
+	})
+
+	replicaStateFn = func(_ context.Context, conn ds.Conn) (replicaState, error) {
+		db := conn.(*lsnConn).db
+		if db.fail.Load() {
+			return replicaState{}, errors.New("replica is unreachable")
+		}
+		return replicaState{
+			lsn: ds.LSN(db.lsn.Load()),
+			lag: time.Duration(db.lag.Load()),
+		}, nil
+	}
+	primaryLSNFn = func(_ context.Context, conn ds.Conn) (ds.LSN, error) {
+		c, ok := conn.(*lsnConn)
+		if !ok {
+			return 0, errors.New("primary LSN is not available")
+		}
+		return ds.LSN(c.db.lsn.Load()), nil
+	}
+}
+
+func TestGetSecondaryUsesTrackedLSN(t *testing.T) {
+	stubReplayLSN(t)
+
+	// Per-request checks must not run while the tracker is on.
+	orig := replicaHasLSNFn
+	defer func() { replicaHasLSNFn = orig }()
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		t.Error("unexpected per-request LSN check")
+		return false, nil
+	}
+
+	replica1, replica2 := &lsnDB{}, &lsnDB{}
+	replica1.lsn.Store(0x10)
+	replica2.lsn.Store(0x5)
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": replica1,
+			"replica2": replica2,
+		},
+	}
+	p.startLSNTracker(5 * time.Millisecond)
+	defer p.Close()
+
+	ctx := context.Background()
+
+	pc, id, err := p.GetSecondary(ctx, "0/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != "replica1" {
+		t.Fatalf("expected replica1, got %s", id)
+	}
+
+	// A waiting caller is woken when a replica catches up.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		replica2.lsn.Store(0x30)
+	}()
+
+	pc, id, err = p.GetSecondary(ctx, "0/20")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != "replica2" {
+		t.Fatalf("expected replica2 after catching up, got %s", id)
+	}
+
+	pc, id, err = p.GetSecondary(ctx, "1/0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != PrimaryID {
+		t.Fatalf("expected fallback to primary, got %s", id)
+	}
+	if st := p.Stats(); st.LSNWaitTimeouts != 1 {
+		t.Fatalf("expected one LSN wait timeout, got %d", st.LSNWaitTimeouts)
+	}
+}
+
+func TestGetSecondaryRejectsInvalidLSN(t *testing.T) {
+	stubReplayLSN(t)
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": &lsnDB{},
+		},
+	}
+	p.startLSNTracker(5 * time.Millisecond)
+	defer p.Close()
+
+	if _, _, err := p.GetSecondary(context.Background(), "not-an-lsn"); !errors.Is(err, ds.ErrInvalidLSN) {
+		t.Fatalf("expected ErrInvalidLSN, got %v", err)
+	}
+}
+
+func boundedProvider(t *testing.T, track bool) *Provider {
+	t.Helper()
+	stubReplayLSN(t)
+
+	primary, lagging, fresh := &lsnDB{}, &lsnDB{}, &lsnDB{}
+	primary.lsn.Store(1000)
+	lagging.lsn.Store(100)
+	lagging.lag.Store(int64(5 * time.Second))
+	fresh.lsn.Store(990)
+	fresh.lag.Store(int64(100 * time.Millisecond))
+
+	p := &Provider{
+		primary: primary,
+		secondaries: map[ds.ServerID]dbHandle{
+			"lagging": lagging,
+			"fresh":   fresh,
+		},
+	}
+	if !track {
+		return p
+	}
+
+	p.startLSNTracker(5 * time.Millisecond)
+	t.Cleanup(func() { _ = p.Close() })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !p.lsn.withinBounds("fresh", ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Second}) {
+		if time.Now().After(deadline) {
+			t.Fatal("tracker did not record replica states")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return p
+}
+
+func TestGetSecondaryWithConsistency(t *testing.T) {
+	for _, track := range []bool{false, true} {
+		p := boundedProvider(t, track)
+		ctx := context.Background()
+
+		tests := []struct {
+			opts ds.ReadOptions
+			want ds.ServerID
+		}{
+			{ds.ReadOptions{Consistency: ds.Strong}, PrimaryID},
+			{ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLagBytes: 50}, "fresh"},
+			{ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Second}, "fresh"},
+			{ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLagBytes: 500, MaxLag: 10 * time.Second}, "fresh"},
+			{ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLagBytes: 5}, PrimaryID},
+			{ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Millisecond}, PrimaryID},
+		}
+
+		for _, tt := range tests {
+			pc, id, err := p.GetSecondaryWith(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("track=%v %+v: unexpected error: %v", track, tt.opts, err)
+			}
+			pc.Release()
+
+			if id != tt.want {
+				t.Fatalf("track=%v %+v: expected %s, got %s", track, tt.opts, tt.want, id)
+			}
+		}
+	}
+}
+
+func TestGetSecondaryWithInvalidOptions(t *testing.T) {
+	p := &Provider{primary: &fakeDB{}}
+
+	_, _, err := p.GetSecondaryWith(context.Background(), ds.ReadOptions{Consistency: ds.BoundedStaleness})
+	if !errors.Is(err, ds.ErrInvalidReadOptions) {
+		t.Fatalf("expected ErrInvalidReadOptions, got %v", err)
+	}
+}
+
+func TestGetSecondaryWithDisconnectedReplica(t *testing.T) {
+	for _, track := range []bool{false, true} {
+		p := boundedProvider(t, track)
+
+		// A standby cut off from the primary has replayed all WAL it
+		// received and reports its lag as unknown.
+		fresh := p.secondaries["fresh"].(*lsnDB)
+		fresh.lsn.Store(1000)
+		fresh.lag.Store(-1)
+
+		if track {
+			deadline := time.Now().Add(2 * time.Second)
+			for p.lsn.withinBounds("fresh", ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Second}) {
+				if time.Now().After(deadline) {
+					t.Fatal("tracker did not record the unknown lag")
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		pc, id, err := p.GetSecondaryWith(context.Background(), ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Second})
+		if err != nil {
+			t.Fatalf("track=%v: unexpected error: %v", track, err)
+		}
+		pc.Release()
+
+		if id != PrimaryID {
+			t.Fatalf("track=%v: expected primary for a replica with unknown lag, got %s", track, id)
+		}
+	}
+}
+
+func TestQueryReplicaStateUnknownLag(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetSecondary()
+	p.ExpectQuery(`pg_stat_wal_receiver`).
+		WillReturnRows(dstest.NewRows("lsn", "lag").AddRow("0/3E8", -1.0))
+
+	pc, _, err := p.GetSecondary(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	st, err := queryReplicaState(context.Background(), pc.Conn())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.lsn != 1000 || st.lag >= 0 {
+		t.Fatalf("expected LSN 0/3E8 with unknown lag, got %+v", st)
+	}
+}
+
+func TestReplicaStateQuery(t *testing.T) {
+	connStr := os.Getenv(ENV_PG_CONN)
+	if connStr == "" {
+		t.Skipf("%s environment variable is not set", ENV_PG_CONN)
+	}
+
+	d := newDB(PrimaryID, connStr, nil, nil)
+	defer d.close()
+
+	pc, err := d.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer pc.Release()
+
+	// A server not in recovery reports its position and no lag.
+	st, err := queryReplicaState(context.Background(), pc.Conn())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.lsn == 0 || st.lag != 0 {
+		t.Fatalf("unexpected state of a primary: %+v", st)
+	}
+}
+
+func TestGetSecondarySkipsFailingReplica(t *testing.T) {
+	p := boundedProvider(t, true)
+	p.wait = LSNWaitConfig{MaxWait: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	bounded := ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLagBytes: 50}
+	get := func(opts ds.ReadOptions) ds.ServerID {
+		t.Helper()
+
+		pc, id, err := p.GetSecondaryWith(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pc.Release()
+		return id
+	}
+
+	if id := get(bounded); id != "fresh" {
+		t.Fatalf("expected fresh, got %s", id)
+	}
+
+	p.secondaries["fresh"].(*lsnDB).fail.Store(true)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.lsn.withinBounds("fresh", bounded) {
+		if time.Now().After(deadline) {
+			t.Fatal("failing replica still within bounds")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if id := get(bounded); id != PrimaryID {
+		t.Fatalf("expected primary for bounded staleness, got %s", id)
+	}
+	ryw := ds.ReadOptions{Consistency: ds.ReadYourWrites, MinLSN: 990}
+	if id := get(ryw); id != PrimaryID {
+		t.Fatalf("expected primary for read-your-writes, got %s", id)
+	}
+}
+
+func TestLSNTrackerIgnoresStaleState(t *testing.T) {
+	tr := &lsnTracker{
+		interval:       10 * time.Millisecond,
+		primary:        100,
+		primaryKnown:   true,
+		primaryChecked: time.Now(),
+		states: map[ds.ServerID]replicaState{
+			"replica1": {lsn: 100, checked: time.Now()},
+			"replica2": {lsn: 100, checked: time.Now().Add(-time.Minute)},
+		},
+	}
+	opts := ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLagBytes: 10}
+
+	if !tr.withinBounds("replica1", opts) || !tr.reached("replica1", 100) {
+		t.Fatal("expected a fresh state to qualify")
+	}
+	if tr.withinBounds("replica2", opts) || tr.reached("replica2", 100) {
+		t.Fatal("expected a stale state to be ignored")
+	}
+}
+
+func TestNewLSNTrackerDisabledByDefault(t *testing.T) {
+	p, err := New(&Config{
+		PrimaryConnStr: "postgres://localhost/primary",
+		Secondaries:    map[ds.ServerID]string{"replica1": "postgres://localhost/replica1"},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer p.Close()
+
+	if p.(*Provider).lsn != nil {
+		t.Fatal("expected no LSN tracker without LSNTrackInterval")
+	}
+}
+
+func TestLSNTrackerPollsPrimaryOnDemand(t *testing.T) {
+	stubReplayLSN(t)
+
+	var primaryPolls atomic.Int32
+	queryPrimary := primaryLSNFn
+	primaryLSNFn = func(ctx context.Context, conn ds.Conn) (ds.LSN, error) {
+		primaryPolls.Add(1)
+		return queryPrimary(ctx, conn)
+	}
+
+	primary, replica := &lsnDB{}, &lsnDB{}
+	primary.lsn.Store(1000)
+	replica.lsn.Store(990)
+
+	p := &Provider{
+		primary:     primary,
+		secondaries: map[ds.ServerID]dbHandle{"replica1": replica},
+	}
+	p.startLSNTracker(5 * time.Millisecond)
+	defer p.Close()
+
+	get := func(opts ds.ReadOptions) ds.ServerID {
+		t.Helper()
+
+		pc, id, err := p.GetSecondaryWith(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pc.Release()
+		return id
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !p.lsn.reached("replica1", 990) {
+		if time.Now().After(deadline) {
+			t.Fatal("tracker did not record replica states")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if id := get(ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Second}); id != "replica1" {
+		t.Fatalf("expected replica1, got %s", id)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := primaryPolls.Load(); n != 0 {
+		t.Fatalf("expected no primary polls without a byte bound, got %d", n)
+	}
+
+	if id := get(ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLagBytes: 50}); id != "replica1" {
+		t.Fatalf("expected replica1, got %s", id)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for primaryPolls.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the tracker to keep polling the primary")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,124 @@
+package pgds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dronm/ds/v4"
+)
+
+// MaxNotifyPayload is the largest payload in bytes the server accepts
+// for a notification.
+const MaxNotifyPayload = 7999
+
+var ErrPayloadTooLarge = errors.New("pgds: notification payload too large")
+
+// Publish sends payload encoded as JSON to channel with pg_notify.
+// Sent on a ds.Tx, the notification is delivered on commit and
+// dropped on rollback. Payloads encoding to more than MaxNotifyPayload
+// bytes fail with ErrPayloadTooLarge without reaching the server.
+func Publish[T any](ctx context.Context, q ds.Querier, channel string, payload T) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("pgds: encode notification for %q: %w", channel, err)
+	}
+	if len(data) > MaxNotifyPayload {
+		return fmt.Errorf("%w: %d bytes on %q, limit %d",
+			ErrPayloadTooLarge, len(data), channel, MaxNotifyPayload)
+	}
+
+	_, err = q.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(data))
+	return err
+}
+
+// Message is a notification with its JSON payload decoded.
+type Message[T any] struct {
+	Notification
+	// Value is the decoded payload, the zero value if Err is set.
+	Value T
+	// Err is the decoding error. Payload keeps the raw text.
+	Err error
+}
+
+// TypedSubscription delivers the notifications of one channel decoded
+// into T. It is created by Subscribe.
+type TypedSubscription[T any] struct {
+	sub  *Subscription
+	c    chan Message[T]
+	done chan struct{}
+
+	closeOnce sync.Once
+}
+
+// Subscribe subscribes to channel on l like Listener.Subscribe and
+// decodes every payload as JSON into T. Payloads that fail to decode
+// are delivered with Err set rather than dropped.
+//
+//	sub, err := pgds.Subscribe[OrderEvent](ctx, l, "orders")
+//	for m := range sub.C() {
+//		if m.Err != nil {
+//			log.Printf("bad payload %q: %v", m.Payload, m.Err)
+//			continue
+//		}
+//		handle(m.Value)
+//	}
+func Subscribe[T any](ctx context.Context, l *Listener, channel string) (*TypedSubscription[T], error) {
+	sub, err := l.Subscribe(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TypedSubscription[T]{
+		sub:  sub,
+		c:    make(chan Message[T]),
+		done: make(chan struct{}),
+	}
+	go s.run()
+
+	return s, nil
+}
+
+func (s *TypedSubscription[T]) run() {
+	defer close(s.c)
+
+	for n := range s.sub.C() {
+		m := Message[T]{Notification: n}
+		if err := json.Unmarshal([]byte(n.Payload), &m.Value); err != nil {
+			m.Value, m.Err = *new(T), err
+		}
+
+		select {
+		case s.c <- m:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Channel returns the subscribed channel name.
+func (s *TypedSubscription[T]) Channel() string {
+	return s.sub.Channel()
+}
+
+// C returns the channel decoded notifications are delivered on. It is
+// closed when the subscription or the listener is closed.
+func (s *TypedSubscription[T]) C() <-chan Message[T] {
+	return s.c
+}
+
+// Missed receives a value when notifications may have been lost.
+// See Subscription.Missed.
+func (s *TypedSubscription[T]) Missed() <-chan struct{} {
+	return s.sub.Missed()
+}
+
+// Close stops the subscription.
+func (s *TypedSubscription[T]) Close() {
+	s.closeOnce.Do(func() {
+		s.sub.Close()
+		close(s.done)
+	})
+}
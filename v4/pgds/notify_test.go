@@ -0,0 +1,137 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+type orderEvent struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+func TestPublish(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`^SELECT pg_notify\(\$1, \$2\)$`).
+		WithArgs("orders", `{"id":1,"status":"paid"}`).
+		WillReturnResult(1)
+
+	pc, _, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+
+	if err := Publish(context.Background(), pc.Conn(), "orders", orderEvent{ID: 1, Status: "paid"}); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+
+	// Rejected before reaching the connection.
+	err = Publish(context.Background(), pc.Conn(), "orders", strings.Repeat("x", MaxNotifyPayload))
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+	if err := Publish(context.Background(), pc.Conn(), "orders", make(chan int)); err == nil {
+		t.Fatal("expected an encoding error")
+	}
+
+	pc.Release()
+	if err := p.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTypedSubscription(t *testing.T) {
+	l := &Listener{
+		cfg:  ListenerConfig{}.withDefaults(),
+		subs: make(map[string]map[*Subscription]struct{}),
+	}
+	s := &TypedSubscription[orderEvent]{
+		sub:  subscribe(l, "orders"),
+		c:    make(chan Message[orderEvent]),
+		done: make(chan struct{}),
+	}
+	go s.run()
+
+	l.dispatch(Notification{Channel: "orders", Payload: `{"id":7,"status":"new"}`})
+	l.dispatch(Notification{Channel: "orders", Payload: `not json`})
+
+	m := <-s.C()
+	if m.Err != nil || m.Value != (orderEvent{ID: 7, Status: "new"}) {
+		t.Fatalf("unexpected message %+v", m)
+	}
+	m = <-s.C()
+	if m.Err == nil || m.Payload != "not json" || m.Value != (orderEvent{}) {
+		t.Fatalf("expected a decode error with the raw payload, got %+v", m)
+	}
+
+	s.Close()
+	s.Close()
+	if _, ok := <-s.C(); ok {
+		t.Fatal("expected a closed channel")
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	connStr := os.Getenv(ENV_PG_CONN)
+	if connStr == "" {
+		t.Skipf("%s environment variable is not set", ENV_PG_CONN)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := New(&Config{PrimaryConnStr: connStr})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer provider.Close()
+
+	l, err := provider.(*Provider).NewListener(ListenerConfig{})
+	if err != nil {
+		t.Fatalf("NewListener() failed: %v", err)
+	}
+	defer l.Close()
+
+	sub, err := Subscribe[orderEvent](ctx, l, "ds_notify_test")
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer sub.Close()
+
+	pc, _, err := provider.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer pc.Release()
+
+	// A rolled back notification is never delivered.
+	_ = ds.WithTx(ctx, pc.Conn(), func(ctx context.Context, tx ds.Tx) error {
+		if err := Publish(ctx, tx, "ds_notify_test", orderEvent{ID: 1}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	err = ds.WithTx(ctx, pc.Conn(), func(ctx context.Context, tx ds.Tx) error {
+		return Publish(ctx, tx, "ds_notify_test", orderEvent{ID: 2, Status: "paid"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() failed: %v", err)
+	}
+
+	select {
+	case m := <-sub.C():
+		if m.Err != nil || m.Value != (orderEvent{ID: 2, Status: "paid"}) {
+			t.Fatalf("unexpected message %+v", m)
+		}
+	case <-ctx.Done():
+		t.Fatal("notification not received")
+	}
+}
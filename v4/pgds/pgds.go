@@ -6,6 +6,8 @@ package pgds
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -16,7 +18,13 @@ import (
 	"github.com/dronm/ds/v4"
 )
 
-const ErrCodeUniqueViolation = "23505"
+const (
+	ErrCodeUniqueViolation      = "23505"
+	ErrCodeSerializationFailure = "40001"
+	ErrCodeDeadlockDetected     = "40P01"
+)
+
+var _ ds.ConsistentReader = (*Provider)(nil)
 
 var replicaHasLSNFn = replicaHasLSN
 
@@ -37,10 +45,15 @@ SELECT coalesce(
 	0
 ) >= 0
 `
-	maxLSNWait  = 300 * time.Millisecond
-	lsnPollStep = 50 * time.Millisecond
 )
 
+// dbHandle is the part of a server pool used by Provider.
+// It is an interface so routing can be tested without a database.
+type dbHandle interface {
+	acquire(ctx context.Context) (ds.PoolConn, error)
+	close() error
+}
+
 // OnDBNotification is a callback for PostgreSQL LISTEN/NOTIFY.
 type OnDBNotification = pgconn.NotificationHandler
 
@@ -51,7 +64,34 @@ type OnDBNotification = pgconn.NotificationHandler
 type Config struct {
 	PrimaryConnStr string
 	Secondaries    map[ds.ServerID]string
+	// OnNotification is called for notifications received by primary
+	// pool connections. Prefer a Listener, which keeps a dedicated
+	// connection listening.
 	OnNotification OnDBNotification
+	// Hooks observe every operation on leased connections.
+	Hooks []ds.Hook
+	// Logger receives records about pools, acquisitions and routing
+	// decisions and, through ds.NewLogHook, about queries.
+	// Nil disables logging.
+	Logger *slog.Logger
+	// LogOptions configures query records written to Logger.
+	LogOptions ds.LogOptions
+	// HealthCheck, if set, enables background health checks that
+	// exclude failing secondaries from GetSecondary.
+	HealthCheck *HealthCheckConfig
+	// Balancer orders secondaries for GetSecondary.
+	// Nil selects round robin.
+	Balancer Balancer
+	// LSNTrackInterval, if positive, enables a background tracker that
+	// records the replay LSN and lag of every secondary this often, so
+	// GetSecondary with a minimum LSN and GetSecondaryWith need no extra
+	// round trips. The primary WAL position is polled only once a read
+	// bounded by MaxLagBytes needs it. Zero disables the tracker and
+	// replicas are queried on every such call instead.
+	LSNTrackInterval time.Duration
+	// LSNWait controls waiting for replicas to reach a minimum LSN.
+	// It can be overridden per call with WithLSNWait.
+	LSNWait LSNWaitConfig
 }
 
 //
@@ -71,17 +111,38 @@ func New(cfg any) (ds.Provider, error) {
 		return nil, errors.New("pgds: PrimaryConnStr is required")
 	}
 
+	primary := newDB(PrimaryID, c.PrimaryConnStr, c.OnNotification, c.Logger)
+	primary.isPrimary = true
+
 	p := &Provider{
-		primary: newDB(c.PrimaryConnStr, c.OnNotification),
+		primary:        primary,
+		primaryConnStr: c.PrimaryConnStr,
+		hooks:          c.Hooks,
+		logger:         c.Logger,
+		balancer:       c.Balancer,
+		wait:           c.LSNWait,
+	}
+	if p.balancer == nil {
+		p.balancer = NewRoundRobin()
+	}
+	if c.Logger != nil {
+		p.hooks = append(append([]ds.Hook(nil), c.Hooks...), ds.NewLogHook(c.Logger, c.LogOptions))
 	}
 
 	if len(c.Secondaries) > 0 {
-		p.secondaries = make(map[ds.ServerID]*db, len(c.Secondaries))
+		p.secondaries = make(map[ds.ServerID]dbHandle, len(c.Secondaries))
 		for id, connStr := range c.Secondaries {
-			p.secondaries[id] = newDB(connStr, nil)
+			p.secondaries[id] = newDB(id, connStr, nil, c.Logger)
 		}
 	}
 
+	if c.HealthCheck != nil {
+		p.startHealthChecks(*c.HealthCheck)
+	}
+	if c.LSNTrackInterval > 0 {
+		p.startLSNTracker(c.LSNTrackInterval)
+	}
+
 	return p, nil
 }
 
@@ -90,8 +151,25 @@ func New(cfg any) (ds.Provider, error) {
 //
 
 type Provider struct {
-	primary     *db
-	secondaries map[ds.ServerID]*db
+	primary        dbHandle
+	primaryConnStr string
+	secondaries    map[ds.ServerID]dbHandle
+	hooks          []ds.Hook
+	logger         *slog.Logger
+	balancer       Balancer
+	wait           LSNWaitConfig
+	stats          routingStats
+	health         *healthChecker
+	lsn            *lsnTracker
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+func (p *Provider) log() *slog.Logger {
+	if p.logger == nil {
+		return discardLogger
+	}
+	return p.logger
 }
 
 func (p *Provider) PrimaryPool() (*pgxpool.Pool, error) {
@@ -99,14 +177,17 @@ func (p *Provider) PrimaryPool() (*pgxpool.Pool, error) {
 		return nil, ErrNoPrimaryPool
 	}
 
-	p.primary.mu.Lock()
-	defer p.primary.mu.Unlock()
+	d, ok := p.primary.(*db)
+	if !ok {
+		return nil, ErrNoPrimaryPool
+	}
 
-	if p.primary.pool == nil {
+	pool := d.currentPool()
+	if pool == nil {
 		return nil, ErrNoPrimaryPool
 	}
 
-	return p.primary.pool, nil
+	return pool, nil
 }
 
 func (p *Provider) GetPrimary(
@@ -117,15 +198,39 @@ func (p *Provider) GetPrimary(
 		return nil, "", err
 	}
 
-	return c, PrimaryID, nil
+	return ds.WithHooks(c, PrimaryID, p.hooks...), PrimaryID, nil
 }
 
-// GetSecondary returns a secondary whose replay LSN
-// is >= minLSN. If minLSN is empty, returns any secondary.
-// Falls back to primary if no suitable replica is found.
+// GetSecondary is GetSecondaryLSN with minLSN in the "X/Y" form.
+// An empty minLSN returns any secondary, a malformed one
+// returns an error wrapping ds.ErrInvalidLSN.
 func (p *Provider) GetSecondary(
 	ctx context.Context,
 	minLSN string,
+) (ds.PoolConn, ds.ServerID, error) {
+	if minLSN == "" {
+		return p.GetSecondaryLSN(ctx, 0)
+	}
+
+	lsn, err := ds.ParseLSN(minLSN)
+	if err != nil {
+		return nil, "", err
+	}
+	return p.GetSecondaryLSN(ctx, lsn)
+}
+
+// GetSecondaryLSN returns a secondary whose replay LSN
+// is >= minLSN. If minLSN is zero, returns any secondary.
+// Replay LSNs come from the background tracker if LSNTrackInterval
+// is set and are queried on every attempt otherwise; callers wait for
+// a replica at minLSN for the LSNWait budget.
+// Replicas are tried in the order chosen by the balancer,
+// replicas ejected by the health checker are skipped.
+// If no suitable replica is found, the LSNWait fallback policy
+// applies: the primary is returned by default.
+func (p *Provider) GetSecondaryLSN(
+	ctx context.Context,
+	minLSN ds.LSN,
 ) (ds.PoolConn, ds.ServerID, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, "", err
@@ -136,51 +241,296 @@ func (p *Provider) GetSecondary(
 	}
 
 	// No LSN constraint: return first available replica.
-	if minLSN == "" {
-		for id, db := range p.secondaries {
-			c, err := db.acquire(ctx)
-			if err == nil {
-				return c, id, nil
-			}
+	if minLSN == 0 {
+		if c, id := p.acquireFirst(ctx, p.candidates()); c != nil {
+			p.stats.server(id).secondaryServed.Add(1)
+			return ds.WithHooks(c, id, p.hooks...), id, nil
 		}
 
+		p.stats.primaryFallbacks.Add(1)
+		p.log().WarnContext(ctx, "pgds: no secondary available, falling back to primary")
+
 		return p.GetPrimary(ctx)
 	}
 
-	deadline := time.Now().Add(maxLSNWait)
+	w := p.lsnWait(ctx)
+	start := time.Now()
 
-	for {
-		if err := ctx.Err(); err != nil {
+	// A zero deadline waits until ctx is done.
+	var deadline time.Time
+	if w.Fallback != FallbackWait {
+		deadline = start.Add(max(w.MaxWait, 0))
+	}
+
+	var (
+		pc  ds.PoolConn
+		id  ds.ServerID
+		err error
+	)
+	if p.lsn != nil {
+		pc, id, err = p.waitTrackedSecondary(ctx, minLSN, deadline)
+	} else {
+		pc, id, err = p.pollSecondary(ctx, minLSN, deadline, w)
+	}
+	if err != nil {
+		if w.Fallback == FallbackWait {
+			p.stats.lsnWaitTimeouts.Add(1)
+			return nil, "", fmt.Errorf("%w: %w", ds.ErrReplicaNotCaughtUp, err)
+		}
+		return nil, "", err
+	}
+	if pc != nil {
+		p.log().DebugContext(ctx, "pgds: replica caught up",
+			slog.String("server", string(id)),
+			slog.String("min_lsn", minLSN.String()),
+			slog.Duration("waited", time.Since(start)),
+		)
+		p.stats.server(id).secondaryServed.Add(1)
+		return ds.WithHooks(pc, id, p.hooks...), id, nil
+	}
+
+	p.stats.lsnWaitTimeouts.Add(1)
+
+	if w.Fallback == FallbackError {
+		p.log().WarnContext(ctx, "pgds: no replica caught up",
+			slog.String("min_lsn", minLSN.String()),
+			slog.Duration("waited", time.Since(start)),
+		)
+		return nil, "", ds.ErrReplicaNotCaughtUp
+	}
+
+	p.stats.primaryFallbacks.Add(1)
+	p.log().WarnContext(ctx, "pgds: no replica caught up, falling back to primary",
+		slog.String("min_lsn", minLSN.String()),
+		slog.Duration("waited", time.Since(start)),
+	)
+
+	return p.GetPrimary(ctx)
+}
+
+// GetSecondaryWith returns a connection satisfying opts. Strong reads
+// are served by the primary, ReadYourWrites reads wait briefly for a
+// replica at MinLSN and BoundedStaleness reads take the first replica
+// within the lag bounds without waiting. Falls back to primary if no
+// suitable replica is found.
+//
+// With the LSN tracker enabled, lag is measured against positions polled
+// every LSNTrackInterval, so bounds are precise to about that interval.
+func (p *Provider) GetSecondaryWith(
+	ctx context.Context,
+	opts ds.ReadOptions,
+) (ds.PoolConn, ds.ServerID, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	switch opts.Consistency {
+	case ds.Strong:
+		return p.GetPrimary(ctx)
+	case ds.Eventual:
+		return p.GetSecondaryLSN(ctx, 0)
+	case ds.ReadYourWrites:
+		return p.GetSecondaryLSN(ctx, opts.MinLSN)
+	}
+
+	return p.getBoundedSecondary(ctx, opts)
+}
+
+func (p *Provider) getBoundedSecondary(
+	ctx context.Context,
+	opts ds.ReadOptions,
+) (ds.PoolConn, ds.ServerID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(p.secondaries) == 0 {
+		return p.GetPrimary(ctx)
+	}
+
+	var (
+		pc  ds.PoolConn
+		id  ds.ServerID
+		err error
+	)
+	if p.lsn != nil {
+		pc, id, err = p.trackedBoundedSecondary(ctx, opts)
+	} else {
+		pc, id, err = p.checkBoundedSecondary(ctx, opts)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if pc != nil {
+		p.stats.server(id).secondaryServed.Add(1)
+		return ds.WithHooks(pc, id, p.hooks...), id, nil
+	}
+
+	p.stats.primaryFallbacks.Add(1)
+	p.log().WarnContext(ctx, "pgds: no replica within staleness bound, falling back to primary",
+		slog.Int64("max_lag_bytes", opts.MaxLagBytes),
+		slog.Duration("max_lag", opts.MaxLag),
+	)
+
+	return p.GetPrimary(ctx)
+}
+
+// trackedBoundedSecondary acquires from the first replica in balancer
+// order that the LSN tracker reports within bounds.
+func (p *Provider) trackedBoundedSecondary(
+	ctx context.Context,
+	opts ds.ReadOptions,
+) (ds.PoolConn, ds.ServerID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if opts.MaxLagBytes > 0 && !p.lsn.trackPrimary(p.primary) {
+		// Until the tracker has polled the primary, query it directly.
+		lsn, err := p.lsn.fetchPrimary(ctx, p.primary)
+		if err != nil {
 			return nil, "", err
 		}
-		if !time.Now().Before(deadline) {
-			break
+		p.lsn.recordPrimary(lsn, nil)
+	}
+
+	var bounded []Replica
+	for _, r := range p.candidates() {
+		if p.lsn.withinBounds(r.ID, opts) {
+			bounded = append(bounded, r)
 		}
+	}
 
-		for id, db := range p.secondaries {
-			if err := ctx.Err(); err != nil {
-				return nil, "", err
-			}
+	pc, id := p.acquireFirst(ctx, bounded)
+	return pc, id, nil
+}
 
-			pc, err := db.acquire(ctx)
-			if err != nil {
-				continue
-			}
+// checkBoundedSecondary queries the primary position and replica
+// states on every call, probing all replicas concurrently.
+// It is used when the LSN tracker is disabled.
+func (p *Provider) checkBoundedSecondary(
+	ctx context.Context,
+	opts ds.ReadOptions,
+) (ds.PoolConn, ds.ServerID, error) {
+	var (
+		primary      ds.LSN
+		primaryKnown bool
+	)
+	if opts.MaxLagBytes > 0 {
+		pc, err := p.primary.acquire(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		primary, err = primaryLSNFn(ctx, pc.Conn())
+		pc.Release()
+		if err != nil {
+			return nil, "", err
+		}
+		primaryKnown = true
+	}
+
+	pc, id := p.probe(ctx, p.candidates(), p.lsnWait(ctx).PollStep, "lag", func(ctx context.Context, conn ds.Conn) (bool, error) {
+		st, err := replicaStateFn(ctx, conn)
+		return err == nil && withinBounds(st, primary, primaryKnown, opts), err
+	})
+	if err := ctx.Err(); err != nil {
+		if pc != nil {
+			pc.Release()
+		}
+		return nil, "", err
+	}
+
+	return pc, id, nil
+}
+
+// waitTrackedSecondary waits until the LSN tracker reports a replica
+// at minLSN or the deadline passes. Replicas at minLSN are tried one at
+// a time in balancer order. It returns a nil connection if no replica
+// caught up in time. A zero deadline waits until
+// ctx is done.
+func (p *Provider) waitTrackedSecondary(
+	ctx context.Context,
+	minLSN ds.LSN,
+	deadline time.Time,
+) (ds.PoolConn, ds.ServerID, error) {
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
 
-			ok, err := replicaHasLSNFn(ctx, pc.Conn(), minLSN)
-			if err == nil && ok {
-				return pc, id, nil
+	for {
+		changed := p.lsn.changed()
+
+		var caughtUp []Replica
+		for _, r := range p.candidates() {
+			if p.lsn.reached(r.ID, minLSN) {
+				caughtUp = append(caughtUp, r)
 			}
+		}
+		if pc, id := p.acquireFirst(ctx, caughtUp); pc != nil {
+			return pc, id, nil
+		}
 
-			pc.Release()
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-expired:
+			return nil, "", nil
+		case <-changed:
+		}
+	}
+}
+
+// pollSecondary checks replicas for minLSN with a query on every
+// attempt, probing all replicas concurrently and taking the qualifying
+// one first in balancer order that answers within the poll step. It is
+// used when the LSN tracker is disabled and returns a nil connection if
+// no replica caught up before the deadline.
+// A zero deadline polls until ctx is done.
+func (p *Provider) pollSecondary(
+	ctx context.Context,
+	minLSN ds.LSN,
+	deadline time.Time,
+	w LSNWaitConfig,
+) (ds.PoolConn, ds.ServerID, error) {
+	step := w.PollStep
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
 		}
 
-		if !sleepWithContext(ctx, time.Until(deadline)) {
+		pc, id := p.probe(ctx, p.candidates(), step, "LSN", func(ctx context.Context, conn ds.Conn) (bool, error) {
+			return replicaHasLSNFn(ctx, conn, minLSN.String())
+		})
+		if pc != nil {
+			return pc, id, nil
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, "", nil
+		}
+
+		wait := step
+		if !deadline.IsZero() {
+			wait = min(wait, time.Until(deadline))
+		}
+		if !sleepWithContext(ctx, wait) {
 			return nil, "", ctx.Err()
 		}
+		step = w.nextStep(step)
 	}
+}
 
-	return p.GetPrimary(ctx)
+// acquireSecondary acquires a connection from a replica
+// and reports the outcome to the balancer.
+func (p *Provider) acquireSecondary(ctx context.Context, id ds.ServerID) (ds.PoolConn, error) {
+	start := time.Now()
+	pc, err := p.secondaries[id].acquire(ctx)
+	p.observe(id, time.Since(start), err)
+
+	return pc, err
 }
 
 func (p *Provider) Release(pc ds.PoolConn, _ ds.ServerID) {
@@ -190,6 +540,12 @@ func (p *Provider) Release(pc ds.PoolConn, _ ds.ServerID) {
 }
 
 func (p *Provider) Close() error {
+	if p.health != nil {
+		p.health.close()
+	}
+	if p.lsn != nil {
+		p.lsn.close()
+	}
 	if p.primary != nil {
 		_ = p.primary.close()
 	}
@@ -199,16 +555,11 @@ func (p *Provider) Close() error {
 	return nil
 }
 
-func sleepWithContext(ctx context.Context, remaining time.Duration) bool {
-	if remaining <= 0 {
+func sleepWithContext(ctx context.Context, wait time.Duration) bool {
+	if wait <= 0 {
 		return true
 	}
 
-	wait := lsnPollStep
-	if remaining < wait {
-		wait = remaining
-	}
-
 	timer := time.NewTimer(wait)
 	defer timer.Stop()
 
@@ -225,17 +576,33 @@ func sleepWithContext(ctx context.Context, remaining time.Duration) bool {
 //
 
 type db struct {
+	id      ds.ServerID
 	connStr string
 	onNotif OnDBNotification
+	logger  *slog.Logger
+	// isPrimary marks the primary, whose connections report
+	// their WAL position.
+	isPrimary bool
 
 	mu   sync.Mutex
 	pool *pgxpool.Pool
 }
 
-func newDB(connStr string, onNotif OnDBNotification) *db {
+func newDB(
+	id ds.ServerID,
+	connStr string,
+	onNotif OnDBNotification,
+	logger *slog.Logger,
+) *db {
+	if logger == nil {
+		logger = discardLogger
+	}
+
 	return &db{
+		id:      id,
 		connStr: connStr,
 		onNotif: onNotif,
+		logger:  logger,
 	}
 }
 
@@ -247,10 +614,14 @@ func (d *db) acquire(ctx context.Context) (ds.PoolConn, error) {
 
 	c, err := pool.Acquire(ctx)
 	if err != nil {
-		return nil, err
+		d.logger.WarnContext(ctx, "pgds: acquire failed",
+			slog.String("server", string(d.id)),
+			slog.Any("error", err),
+		)
+		return nil, classifyError(err)
 	}
 
-	return wrapPoolConn(c), nil
+	return wrapPoolConn(c, d.isPrimary), nil
 }
 
 func (d *db) getPool(ctx context.Context) (*pgxpool.Pool, error) {
@@ -263,6 +634,10 @@ func (d *db) getPool(ctx context.Context) (*pgxpool.Pool, error) {
 
 	cfg, err := pgxpool.ParseConfig(d.connStr)
 	if err != nil {
+		d.logger.ErrorContext(ctx, "pgds: invalid connection string",
+			slog.String("server", string(d.id)),
+			slog.Any("error", err),
+		)
 		return nil, err
 	}
 	if d.onNotif != nil {
@@ -271,12 +646,40 @@ func (d *db) getPool(ctx context.Context) (*pgxpool.Pool, error) {
 
 	d.pool, err = pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
+		d.logger.ErrorContext(ctx, "pgds: pool creation failed",
+			slog.String("server", string(d.id)),
+			slog.Any("error", err),
+		)
 		return nil, err
 	}
 
+	d.logger.InfoContext(ctx, "pgds: pool created",
+		slog.String("server", string(d.id)),
+		slog.String("host", cfg.ConnConfig.Host),
+		slog.Int("max_conns", int(cfg.MaxConns)),
+	)
+
 	return d.pool, nil
 }
 
+// currentPool returns the pool if it has been created.
+func (d *db) currentPool() *pgxpool.Pool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.pool
+}
+
+// acquiredConns returns the number of leased connections
+// for the balancer.
+func (d *db) acquiredConns() int32 {
+	pool := d.currentPool()
+	if pool == nil {
+		return 0
+	}
+	return pool.Stat().AcquiredConns()
+}
+
 func (d *db) close() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -293,15 +696,16 @@ func (d *db) close() error {
 //
 
 type poolConn struct {
-	c *pgxpool.Conn
+	c       *pgxpool.Conn
+	primary bool
 }
 
-func wrapPoolConn(c *pgxpool.Conn) ds.PoolConn {
-	return &poolConn{c: c}
+func wrapPoolConn(c *pgxpool.Conn, primary bool) ds.PoolConn {
+	return &poolConn{c: c, primary: primary}
 }
 
 func (p *poolConn) Conn() ds.Conn {
-	return &pgConn{conn: p.c.Conn()}
+	return &pgConn{conn: p.c.Conn(), primary: p.primary}
 }
 
 func (p *poolConn) Release() {
@@ -318,17 +722,26 @@ func (p *poolConn) Release() {
 //
 
 type pgConn struct {
-	conn *pgx.Conn
+	conn    *pgx.Conn
+	primary bool
 }
 
-var _ ds.Conn = (*pgConn)(nil)
+var (
+	_ ds.Conn            = (*pgConn)(nil)
+	_ ds.LSNReporter     = (*pgConn)(nil)
+	_ ds.RetryClassifier = (*pgConn)(nil)
+)
 
 func (c *pgConn) Exec(
 	ctx context.Context,
 	sql string,
 	args ...any,
 ) (ds.ExecResult, error) {
-	return c.conn.Exec(ctx, sql, args...)
+	tag, err := c.conn.Exec(ctx, sql, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return tag, nil
 }
 
 func (c *pgConn) Query(
@@ -338,7 +751,7 @@ func (c *pgConn) Query(
 ) (ds.Rows, error) {
 	rows, err := c.conn.Query(ctx, sql, args...)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	return &pgRows{rows: rows}, nil
 }
@@ -358,7 +771,7 @@ func (c *pgConn) Prepare(
 ) (ds.PreparedStatement, error) {
 	_, err := c.conn.Prepare(ctx, name, sql)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	return &pgPreparedStatement{
@@ -367,17 +780,94 @@ func (c *pgConn) Prepare(
 	}, nil
 }
 
+// SendBatch sends the batch in one round trip using pgx pipelining.
+// Outside a transaction the statements run in an implicit transaction,
+// so a failing statement rolls back the ones before it.
+func (c *pgConn) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return sendBatch(ctx, c.conn, b)
+}
+
 func (c *pgConn) Begin(ctx context.Context) (ds.Tx, error) {
 	tx, err := c.conn.Begin(ctx)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	return &pgTx{
+		tx: tx,
+	}, nil
+}
+
+func (c *pgConn) BeginTx(ctx context.Context, opts ds.TxOptions) (ds.Tx, error) {
+	txOpts, err := pgTxOptions(opts)
 	if err != nil {
 		return nil, err
 	}
 
+	tx, err := c.conn.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
 	return &pgTx{
 		tx: tx,
 	}, nil
 }
 
+// pgTxOptions maps opts to pgx.TxOptions. Zero fields are left empty
+// so the server defaults apply.
+func pgTxOptions(opts ds.TxOptions) (pgx.TxOptions, error) {
+	var txOpts pgx.TxOptions
+
+	switch opts.Isolation {
+	case ds.IsolationDefault:
+	case ds.IsolationReadUncommitted:
+		txOpts.IsoLevel = pgx.ReadUncommitted
+	case ds.IsolationReadCommitted:
+		txOpts.IsoLevel = pgx.ReadCommitted
+	case ds.IsolationRepeatableRead:
+		txOpts.IsoLevel = pgx.RepeatableRead
+	case ds.IsolationSerializable:
+		txOpts.IsoLevel = pgx.Serializable
+	default:
+		return txOpts, fmt.Errorf("pgds: unknown isolation level %d", opts.Isolation)
+	}
+
+	switch opts.AccessMode {
+	case ds.AccessDefault:
+	case ds.AccessReadWrite:
+		txOpts.AccessMode = pgx.ReadWrite
+	case ds.AccessReadOnly:
+		txOpts.AccessMode = pgx.ReadOnly
+	default:
+		return txOpts, fmt.Errorf("pgds: unknown access mode %d", opts.AccessMode)
+	}
+
+	if opts.Deferrable {
+		txOpts.DeferrableMode = pgx.Deferrable
+	}
+
+	return txOpts, nil
+}
+
+// IsRetryable classifies errors for ds.WithTxRetry.
+func (c *pgConn) IsRetryable(err error) bool {
+	return IsRetryable(err)
+}
+
+// CurrentLSN returns the current WAL write position of the primary,
+// the position the LSN tracker and replica checks compare against.
+// Connections to secondaries report no position and run no query.
+func (c *pgConn) CurrentLSN(ctx context.Context) (string, error) {
+	if !c.primary {
+		return "", nil
+	}
+
+	var lsn string
+	err := c.conn.QueryRow(ctx, primaryLSNQuery).Scan(&lsn)
+	return lsn, err
+}
+
 //
 // ---------- Prepared statement ----------
 //
@@ -424,17 +914,26 @@ type pgRows struct {
 
 func (r *pgRows) Close() error {
 	r.rows.Close()
-	return r.rows.Err()
+	return classifyError(r.rows.Err())
 }
 
 func (r *pgRows) Err() error {
-	return r.rows.Err()
+	return classifyError(r.rows.Err())
 }
 
 func (r *pgRows) Next() bool {
 	return r.rows.Next()
 }
 
+func (r *pgRows) Columns() ([]string, error) {
+	fields := r.rows.FieldDescriptions()
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Name
+	}
+	return columns, nil
+}
+
 func (r *pgRows) Scan(dest ...any) error {
 	err := r.rows.Scan(dest...)
 	if err == nil {
@@ -444,7 +943,7 @@ func (r *pgRows) Scan(dest ...any) error {
 	if errors.Is(err, pgx.ErrNoRows) {
 		return ds.ErrNoRows
 	}
-	return err
+	return classifyError(err)
 }
 
 type pgRow struct {
@@ -460,9 +959,93 @@ func (r *pgRow) Scan(dest ...any) error {
 	if errors.Is(err, pgx.ErrNoRows) {
 		return ds.ErrNoRows
 	}
-	return err
+	return classifyError(err)
 }
 
+//
+// ---------- Batch ----------
+//
+
+func sendBatch(
+	ctx context.Context,
+	conn interface {
+		SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	},
+	b *ds.Batch,
+) ds.BatchResults {
+	pb := &pgx.Batch{}
+	for _, q := range b.Queries() {
+		pb.Queue(q.SQL, q.Args...)
+	}
+
+	return &pgBatchResults{br: conn.SendBatch(ctx, pb), left: pb.Len()}
+}
+
+type pgBatchResults struct {
+	br     pgx.BatchResults
+	left   int
+	closed bool
+}
+
+func (r *pgBatchResults) take() error {
+	if r.closed {
+		return ds.ErrBatchClosed
+	}
+	if r.left == 0 {
+		return ds.ErrNoBatchResults
+	}
+	r.left--
+	return nil
+}
+
+func (r *pgBatchResults) Exec() (ds.ExecResult, error) {
+	if err := r.take(); err != nil {
+		return nil, err
+	}
+
+	tag, err := r.br.Exec()
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return tag, nil
+}
+
+func (r *pgBatchResults) Query() (ds.Rows, error) {
+	if err := r.take(); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.br.Query()
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &pgRows{rows: rows}, nil
+}
+
+func (r *pgBatchResults) QueryRow() ds.Row {
+	if err := r.take(); err != nil {
+		return &pgRow{row: errRow{err: err}}
+	}
+
+	return &pgRow{row: r.br.QueryRow()}
+}
+
+func (r *pgBatchResults) Close() error {
+	r.closed = true
+	return classifyError(r.br.Close())
+}
+
+// errRow is a pgx.Row failing with err.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
+
+//
+// ---------- Tx ----------
 //
 
 type pgTx struct {
@@ -476,7 +1059,11 @@ func (t *pgTx) Exec(
 	sql string,
 	args ...any,
 ) (ds.ExecResult, error) {
-	return t.tx.Exec(ctx, sql, args...)
+	tag, err := t.tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return tag, nil
 }
 
 func (t *pgTx) Query(
@@ -486,7 +1073,7 @@ func (t *pgTx) Query(
 ) (ds.Rows, error) {
 	rows, err := t.tx.Query(ctx, sql, args...)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	return &pgRows{
@@ -504,6 +1091,22 @@ func (t *pgTx) QueryRow(
 	}
 }
 
+func (t *pgTx) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return sendBatch(ctx, t.tx, b)
+}
+
+// Begin starts a nested transaction backed by a savepoint.
+func (t *pgTx) Begin(ctx context.Context) (ds.Tx, error) {
+	tx, err := t.tx.Begin(ctx)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	return &pgTx{
+		tx: tx,
+	}, nil
+}
+
 func (t *pgTx) Commit(ctx context.Context) error {
 	err := t.tx.Commit(ctx)
 	if err == nil {
@@ -514,11 +1117,11 @@ func (t *pgTx) Commit(ctx context.Context) error {
 		return ds.ErrTxCommitRollback
 	}
 
-	return err
+	return classifyError(err)
 }
 
 func (t *pgTx) Rollback(ctx context.Context) error {
-	return t.tx.Rollback(ctx)
+	return classifyError(t.tx.Rollback(ctx))
 }
 
 // ---------- LSN helper ----------
@@ -537,3 +1140,10 @@ func IsUniqueViolation(err error) bool {
 
 	return errors.As(err, &pgErr) && pgErr.Code == ErrCodeUniqueViolation
 }
+
+// IsRetryable reports whether err is a serialization failure or a
+// deadlock, after which the whole transaction may be run again.
+// It is ds.IsRetryable, also accepting unclassified pgx errors.
+func IsRetryable(err error) bool {
+	return ds.IsRetryable(classifyError(err))
+}
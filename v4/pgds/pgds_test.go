@@ -1,23 +1,37 @@
 package pgds
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
 	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
 )
 
+// ENV_PG_CONN names the environment variable with a connection string
+// to a scratch PostgreSQL database used by integration tests.
+const ENV_PG_CONN = "PG_CONN"
+
 type fakeExecResult struct{}
 
 func (r fakeExecResult) RowsAffected() int64 { return 0 }
 
 type fakeRows struct{}
 
-func (r fakeRows) Close() error           { return nil }
-func (r fakeRows) Err() error             { return nil }
-func (r fakeRows) Next() bool             { return false }
-func (r fakeRows) Scan(dest ...any) error { return nil }
+func (r fakeRows) Close() error               { return nil }
+func (r fakeRows) Err() error                 { return nil }
+func (r fakeRows) Next() bool                 { return false }
+func (r fakeRows) Scan(dest ...any) error     { return nil }
+func (r fakeRows) Columns() ([]string, error) { return nil, nil }
 
 type fakeRow struct {
 	value bool
@@ -52,6 +66,14 @@ func (t *fakeTx) QueryRow(context.Context, string, ...any) ds.Row {
 	return fakeRow{}
 }
 
+func (t *fakeTx) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return ds.SendBatchSequential(ctx, t, b)
+}
+
+func (t *fakeTx) Begin(context.Context) (ds.Tx, error) {
+	return &fakeTx{}, nil
+}
+
 func (t *fakeTx) Commit(context.Context) error   { return nil }
 func (t *fakeTx) Rollback(context.Context) error { return nil }
 
@@ -101,6 +123,14 @@ func (c *fakeConn) Begin(context.Context) (ds.Tx, error) {
 	return &fakeTx{}, nil
 }
 
+func (c *fakeConn) BeginTx(context.Context, ds.TxOptions) (ds.Tx, error) {
+	return &fakeTx{}, nil
+}
+
+func (c *fakeConn) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return ds.SendBatchSequential(ctx, c, b)
+}
+
 type fakePoolConn struct {
 	conn         ds.Conn
 	releaseCount int
@@ -271,3 +301,216 @@ func TestGetSecondaryFallsBackWhenContextCancelled(t *testing.T) {
 		t.Fatalf("expected context.Canceled, got %v", err)
 	}
 }
+
+func TestConformance(t *testing.T) {
+	connStr := os.Getenv(ENV_PG_CONN)
+	if connStr == "" {
+		t.Skipf("%s environment variable is not set", ENV_PG_CONN)
+	}
+
+	dstest.RunConformance(t, func(t *testing.T) ds.Provider {
+		p, err := New(&Config{PrimaryConnStr: connStr})
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		return p
+	})
+}
+
+func TestProviderAppliesHooks(t *testing.T) {
+	var ops []ds.Op
+	hook := ds.HookFuncs{
+		AfterFunc: func(_ context.Context, ev *ds.QueryEvent) {
+			if ev.ServerID != PrimaryID {
+				t.Errorf("expected primary server id, got %s", ev.ServerID)
+			}
+			ops = append(ops, ev.Op)
+		},
+	}
+
+	primaryPC := &fakePoolConn{}
+	p := &Provider{
+		primary: &fakeDB{pc: primaryPC},
+		hooks:   []ds.Hook{hook},
+	}
+
+	pc, _, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := pc.Conn().Exec(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.Release(pc, PrimaryID)
+
+	if len(ops) != 1 || ops[0] != ds.OpExec {
+		t.Fatalf("expected one exec event, got %v", ops)
+	}
+	if primaryPC.releaseCount != 1 {
+		t.Fatalf("expected release to reach pool connection, got %d", primaryPC.releaseCount)
+	}
+}
+
+func TestGetSecondaryLogsFallback(t *testing.T) {
+	orig := replicaHasLSNFn
+	defer func() { replicaHasLSNFn = orig }()
+
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		return false, errors.New("replica is in recovery")
+	}
+
+	var buf bytes.Buffer
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": &fakeDB{},
+		},
+		logger: slog.New(slog.NewTextHandler(&buf, nil)),
+	}
+
+	if _, _, err := p.GetSecondary(context.Background(), "0/FFFFFFFF"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "pgds: replica LSN check failed") || !strings.Contains(out, "server=replica1") {
+		t.Fatalf("expected replica check failure record, got %q", out)
+	}
+	if !strings.Contains(out, "pgds: no replica caught up, falling back to primary") {
+		t.Fatalf("expected fallback record, got %q", out)
+	}
+}
+
+func TestStatsCountRoutingDecisions(t *testing.T) {
+	orig := replicaHasLSNFn
+	defer func() { replicaHasLSNFn = orig }()
+
+	caughtUp := false
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		if caughtUp {
+			return true, nil
+		}
+		return false, errors.New("replica check failed")
+	}
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": &fakeDB{},
+		},
+	}
+
+	ctx := context.Background()
+	if _, _, err := p.GetSecondary(ctx, "0/FFFFFFFF"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	caughtUp = true
+	if _, _, err := p.GetSecondary(ctx, "0/FFFFFFFF"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := p.GetSecondary(ctx, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	st := p.Stats()
+	if st.PrimaryFallbacks != 1 || st.LSNWaitTimeouts != 1 {
+		t.Fatalf("unexpected provider counters: %+v", st)
+	}
+	if len(st.Servers) != 2 || st.Servers[0].ID != PrimaryID || !st.Servers[0].Primary {
+		t.Fatalf("unexpected servers: %+v", st.Servers)
+	}
+
+	replica := st.Servers[1]
+	if replica.ID != "replica1" || replica.SecondaryServed != 2 || replica.ReplicaCheckErrors == 0 {
+		t.Fatalf("unexpected replica stats: %+v", replica)
+	}
+}
+
+func TestPgTxOptions(t *testing.T) {
+	got, err := pgTxOptions(ds.TxOptions{
+		Isolation:  ds.IsolationSerializable,
+		AccessMode: ds.AccessReadOnly,
+		Deferrable: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		AccessMode:     pgx.ReadOnly,
+		DeferrableMode: pgx.Deferrable,
+	}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if got, _ := pgTxOptions(ds.TxOptions{}); got != (pgx.TxOptions{}) {
+		t.Fatalf("expected server defaults, got %+v", got)
+	}
+	if _, err := pgTxOptions(ds.TxOptions{Isolation: 42}); err == nil {
+		t.Fatal("expected error for unknown isolation level")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for code, want := range map[string]bool{
+		ErrCodeSerializationFailure: true,
+		ErrCodeDeadlockDetected:     true,
+		ErrCodeUniqueViolation:      false,
+	} {
+		err := fmt.Errorf("commit: %w", &pgconn.PgError{Code: code})
+		if got := IsRetryable(err); got != want {
+			t.Fatalf("IsRetryable(%s) = %v, expected %v", code, got, want)
+		}
+		// Classified errors agree with ds.IsRetryable.
+		if got := IsRetryable(classifyError(err)); got != want || ds.IsRetryable(classifyError(err)) != want {
+			t.Fatalf("IsRetryable(classified %s) = %v, expected %v", code, got, want)
+		}
+	}
+	if !IsRetryable(ds.ErrDeadlock) {
+		t.Fatal("expected ds.ErrDeadlock to be retryable")
+	}
+
+	if IsRetryable(errors.New("connection reset")) {
+		t.Fatal("expected plain errors not to be retryable")
+	}
+}
+
+func TestCopyToSQL(t *testing.T) {
+	tests := []struct {
+		opts ds.CopyOptions
+		want string
+	}{
+		{ds.CopyOptions{}, "COPY (SELECT 1) TO STDOUT WITH (FORMAT text)"},
+		{
+			ds.CopyOptions{Format: ds.CopyCSV, Header: true, Delimiter: ';'},
+			"COPY (SELECT 1) TO STDOUT WITH (FORMAT csv, HEADER, DELIMITER ';')",
+		},
+		{ds.CopyOptions{Format: ds.CopyCSV, Delimiter: '\''}, "COPY (SELECT 1) TO STDOUT WITH (FORMAT csv, DELIMITER '''')"},
+		{ds.CopyOptions{Format: ds.CopyBinary}, "COPY (SELECT 1) TO STDOUT WITH (FORMAT binary)"},
+	}
+
+	for _, tt := range tests {
+		got, err := copyToSQL("SELECT 1", tt.opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Fatalf("expected %q, got %q", tt.want, got)
+		}
+	}
+
+	if _, err := copyToSQL("SELECT 1", ds.CopyOptions{Format: ds.CopyBinary, Header: true}); err == nil {
+		t.Fatal("expected error for binary COPY with header")
+	}
+}
+
+func TestSecondaryConnReportsNoLSN(t *testing.T) {
+	// No query runs, so the connection is never used.
+	lsn, err := (&pgConn{}).CurrentLSN(context.Background())
+	if err != nil || lsn != "" {
+		t.Fatalf("expected no position from a secondary, got %q, %v", lsn, err)
+	}
+}
@@ -0,0 +1,133 @@
+package pgds
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+// replicaCheck reports whether a replica connection qualifies for a read.
+type replicaCheck func(ctx context.Context, conn ds.Conn) (bool, error)
+
+type probeResult struct {
+	rank int
+	id   ds.ServerID
+	pc   ds.PoolConn
+	ok   bool
+	err  error
+}
+
+// probe runs check on every replica concurrently and returns, of the
+// replicas that qualify, the one first in the given order, which is the
+// balancer order. Once a replica qualifies, replicas ordered before it
+// get up to window to answer, so a slow replica delays a read by at most
+// window. Connections of the other replicas are released as their probes
+// finish. It returns a nil connection if no replica qualifies.
+func (p *Provider) probe(
+	ctx context.Context,
+	replicas []Replica,
+	window time.Duration,
+	what string,
+	check replicaCheck,
+) (ds.PoolConn, ds.ServerID) {
+	if len(replicas) == 0 {
+		return nil, ""
+	}
+
+	results := make(chan probeResult, len(replicas))
+	for rank, r := range replicas {
+		go func(rank int, id ds.ServerID) {
+			pc, err := p.acquireSecondary(ctx, id)
+			if err != nil {
+				results <- probeResult{rank: rank, id: id, err: err}
+				return
+			}
+
+			ok, err := check(ctx, pc.Conn())
+			if err != nil {
+				p.stats.server(id).replicaCheckErrors.Add(1)
+			}
+			results <- probeResult{rank: rank, id: id, pc: pc, ok: ok, err: err}
+		}(rank, r.ID)
+	}
+
+	var (
+		best     *probeResult
+		answered = make([]bool, len(replicas))
+		received int
+		expired  <-chan time.Time
+	)
+	// settled reports whether every replica ordered before best answered.
+	settled := func() bool {
+		return best != nil && !slices.Contains(answered[:best.rank], false)
+	}
+
+	for received < len(replicas) && !settled() {
+		var res probeResult
+		select {
+		case res = <-results:
+		case <-expired:
+			go releaseProbes(results, len(replicas)-received)
+			return best.pc, best.id
+		}
+		received++
+		answered[res.rank] = true
+
+		if res.err == nil && res.ok {
+			if best == nil {
+				timer := time.NewTimer(window)
+				defer timer.Stop()
+				expired = timer.C
+			}
+			if best == nil || res.rank < best.rank {
+				if best != nil {
+					best.pc.Release()
+				}
+				best = &res
+				continue
+			}
+		}
+
+		if res.pc != nil {
+			res.pc.Release()
+			if res.err != nil && ctx.Err() == nil {
+				p.log().WarnContext(ctx, "pgds: replica "+what+" check failed",
+					slog.String("server", string(res.id)),
+					slog.Any("error", res.err),
+				)
+			}
+		}
+	}
+
+	go releaseProbes(results, len(replicas)-received)
+	if best == nil {
+		return nil, ""
+	}
+	return best.pc, best.id
+}
+
+// acquireFirst acquires from the replicas one at a time in the given
+// order, which is the balancer order, and returns the first connection
+// acquired. It is used for replicas already known to qualify, which need
+// no check, so a read leases a single connection. It returns a nil
+// connection if no replica can be acquired.
+func (p *Provider) acquireFirst(ctx context.Context, replicas []Replica) (ds.PoolConn, ds.ServerID) {
+	for _, r := range replicas {
+		if pc, err := p.acquireSecondary(ctx, r.ID); err == nil {
+			return pc, r.ID
+		}
+	}
+	return nil, ""
+}
+
+// releaseProbes releases the connections of n outstanding probes.
+func releaseProbes(results <-chan probeResult, n int) {
+	for range n {
+		if res := <-results; res.pc != nil {
+			res.pc.Release()
+		}
+	}
+}
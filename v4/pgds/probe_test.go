@@ -0,0 +1,183 @@
+package pgds
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+// slowConn marks a replica whose LSN check takes long.
+type slowConn struct {
+	fakeConn
+}
+
+// signalPoolConn reports its release on a channel.
+type signalPoolConn struct {
+	fakePoolConn
+	released chan struct{}
+}
+
+func (c *signalPoolConn) Release() {
+	close(c.released)
+}
+
+func TestPollSecondaryDoesNotWaitForSlowReplica(t *testing.T) {
+	orig := replicaHasLSNFn
+	defer func() { replicaHasLSNFn = orig }()
+
+	replicaHasLSNFn = func(ctx context.Context, conn ds.Conn, _ string) (bool, error) {
+		if _, ok := conn.(*slowConn); ok {
+			select {
+			case <-time.After(200 * time.Millisecond):
+			case <-ctx.Done():
+			}
+		}
+		return true, nil
+	}
+
+	slowPC := &signalPoolConn{
+		fakePoolConn: fakePoolConn{conn: &slowConn{}},
+		released:     make(chan struct{}),
+	}
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			// Sorted first, so a sequential check would wait for it.
+			"a-slow": &fakeDB{pc: slowPC},
+			"b-fast": &fakeDB{},
+		},
+	}
+
+	start := time.Now()
+	pc, id, err := p.GetSecondary(context.Background(), "0/10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+
+	if id != "b-fast" {
+		t.Fatalf("expected b-fast, got %s", id)
+	}
+	if waited := time.Since(start); waited >= 150*time.Millisecond {
+		t.Fatalf("slow replica delayed the read by %v", waited)
+	}
+
+	select {
+	case <-slowPC.released:
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow replica connection was not released")
+	}
+}
+
+// loadedDB reports a pool load to the balancer, delays acquires
+// and counts them.
+type loadedDB struct {
+	dbHandle
+	conns    int32
+	delay    atomic.Int64
+	acquires atomic.Int32
+}
+
+func (d *loadedDB) acquiredConns() int32 { return d.conns }
+
+func (d *loadedDB) acquire(ctx context.Context) (ds.PoolConn, error) {
+	d.acquires.Add(1)
+	select {
+	case <-time.After(time.Duration(d.delay.Load())):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return d.dbHandle.acquire(ctx)
+}
+
+func TestPollSecondaryPrefersBalancerOrder(t *testing.T) {
+	orig := replicaHasLSNFn
+	defer func() { replicaHasLSNFn = orig }()
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		return true, nil
+	}
+
+	busy := &loadedDB{dbHandle: &fakeDB{}, conns: 5}
+	idle := &loadedDB{dbHandle: &fakeDB{}}
+	// The idle replica answers later but within the poll step.
+	idle.delay.Store(int64(20 * time.Millisecond))
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"a-busy": busy,
+			"b-idle": idle,
+		},
+		balancer: NewLeastInUse(),
+	}
+
+	pc, id, err := p.GetSecondary(context.Background(), "0/10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != "b-idle" {
+		t.Fatalf("expected the least loaded replica, got %s", id)
+	}
+}
+
+func TestTrackedGetSecondaryPrefersBalancerOrder(t *testing.T) {
+	stubReplayLSN(t)
+
+	busyLSN, idleLSN := &lsnDB{}, &lsnDB{}
+	busyLSN.lsn.Store(0x10)
+	idleLSN.lsn.Store(0x10)
+	busy := &loadedDB{dbHandle: busyLSN, conns: 5}
+	idle := &loadedDB{dbHandle: idleLSN}
+
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"a-busy": busy,
+			"b-idle": idle,
+		},
+		balancer: NewLeastInUse(),
+	}
+	// Replicas are polled once, so later acquires are the reads'.
+	p.startLSNTracker(time.Hour)
+	defer p.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !p.lsn.reached("a-busy", 0x10) || !p.lsn.reached("b-idle", 0x10) {
+		if time.Now().After(deadline) {
+			t.Fatal("tracker did not record replica states")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	busy.acquires.Store(0)
+	idle.acquires.Store(0)
+
+	ctx := context.Background()
+	reads := []ds.ReadOptions{
+		{Consistency: ds.ReadYourWrites, MinLSN: 0x10},
+		{Consistency: ds.BoundedStaleness, MaxLag: time.Second},
+	}
+	for _, opts := range reads {
+		pc, id, err := p.GetSecondaryWith(ctx, opts)
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", opts, err)
+		}
+		pc.Release()
+		if id != "b-idle" {
+			t.Fatalf("%+v: expected the least loaded replica, got %s", opts, id)
+		}
+	}
+
+	// Replicas known to qualify are not all leased for one read.
+	if n := busy.acquires.Load(); n != 0 {
+		t.Fatalf("expected no acquires from a-busy, got %d", n)
+	}
+	if n := idle.acquires.Load(); n != int32(len(reads)) {
+		t.Fatalf("expected one acquire from b-idle per read, got %d", n)
+	}
+}
@@ -0,0 +1,90 @@
+package pgds
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dronm/ds/v4"
+)
+
+var _ ds.StatsProvider = (*Provider)(nil)
+
+// routingStats holds the counters of routing decisions.
+// The zero value is ready to use.
+type routingStats struct {
+	mu      sync.Mutex
+	servers map[ds.ServerID]*serverCounters
+
+	primaryFallbacks atomic.Int64
+	lsnWaitTimeouts  atomic.Int64
+}
+
+type serverCounters struct {
+	secondaryServed    atomic.Int64
+	replicaCheckErrors atomic.Int64
+}
+
+func (s *routingStats) server(id ds.ServerID) *serverCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.servers[id]
+	if !ok {
+		if s.servers == nil {
+			s.servers = make(map[ds.ServerID]*serverCounters)
+		}
+		c = &serverCounters{}
+		s.servers[id] = c
+	}
+	return c
+}
+
+// Stats returns pool statistics of every server
+// together with routing counters.
+func (p *Provider) Stats() ds.Stats {
+	st := ds.Stats{
+		PrimaryFallbacks: p.stats.primaryFallbacks.Load(),
+		LSNWaitTimeouts:  p.stats.lsnWaitTimeouts.Load(),
+	}
+
+	st.Servers = append(st.Servers, p.serverStats(PrimaryID, p.primary, true))
+
+	ids := make([]ds.ServerID, 0, len(p.secondaries))
+	for id := range p.secondaries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		st.Servers = append(st.Servers, p.serverStats(id, p.secondaries[id], false))
+	}
+
+	return st
+}
+
+func (p *Provider) serverStats(id ds.ServerID, h dbHandle, primary bool) ds.ServerStats {
+	s := ds.ServerStats{ID: id, Primary: primary}
+
+	if d, ok := h.(*db); ok {
+		if pool := d.currentPool(); pool != nil {
+			ps := pool.Stat()
+
+			s.AcquiredConns = ps.AcquiredConns()
+			s.IdleConns = ps.IdleConns()
+			s.TotalConns = ps.TotalConns()
+			s.MaxConns = ps.MaxConns()
+			s.AcquireCount = ps.AcquireCount()
+			s.AcquireDuration = ps.AcquireDuration()
+			s.AcquireWaitCount = ps.EmptyAcquireCount()
+			s.AcquireWaitDuration = ps.EmptyAcquireWaitTime()
+			s.CanceledAcquireCount = ps.CanceledAcquireCount()
+		}
+	}
+
+	c := p.stats.server(id)
+	s.SecondaryServed = c.secondaryServed.Load()
+	s.ReplicaCheckErrors = c.replicaCheckErrors.Load()
+
+	return s
+}
@@ -0,0 +1,114 @@
+package pgds
+
+import (
+	"context"
+	"time"
+)
+
+// LSNFallback is what GetSecondary does when no replica
+// reaches the requested LSN within the wait budget.
+type LSNFallback int
+
+const (
+	// FallbackDefault takes the provider setting, FallbackToPrimary
+	// if the provider does not set one.
+	FallbackDefault LSNFallback = iota
+	// FallbackToPrimary serves the read from the primary.
+	FallbackToPrimary
+	// FallbackError returns ds.ErrReplicaNotCaughtUp.
+	FallbackError
+	// FallbackWait ignores MaxWait and waits until the context is done,
+	// then returns ds.ErrReplicaNotCaughtUp wrapping the context error.
+	FallbackWait
+)
+
+// NoLSNWait as LSNWaitConfig.MaxWait disables waiting: only replicas
+// already at the LSN serve the read, otherwise Fallback applies at once.
+const NoLSNWait time.Duration = -1
+
+const (
+	defaultLSNWait     = 300 * time.Millisecond
+	defaultLSNPollStep = 50 * time.Millisecond
+	defaultMaxPollStep = time.Second
+)
+
+// LSNWaitConfig controls how long GetSecondary waits for a replica
+// to reach a minimum LSN. Zero fields take default values.
+type LSNWaitConfig struct {
+	// MaxWait is the wait budget, 300ms by default. Zero keeps the
+	// default or the provider value; a negative value, such as NoLSNWait,
+	// means no wait.
+	MaxWait time.Duration
+	// PollStep is the delay between replica checks when the LSN tracker
+	// is disabled, 50ms by default. With the tracker enabled waiting
+	// callers are woken by the tracker instead.
+	PollStep time.Duration
+	// PollBackoff multiplies PollStep after every check, up to
+	// MaxPollStep. Values below 1 keep the step constant.
+	PollBackoff float64
+	// MaxPollStep caps the poll step grown by PollBackoff, 1s by default.
+	MaxPollStep time.Duration
+	// Fallback is the policy applied when the budget is exhausted.
+	Fallback LSNFallback
+}
+
+// merge returns c with the non-zero fields of o.
+func (c LSNWaitConfig) merge(o LSNWaitConfig) LSNWaitConfig {
+	if o.MaxWait != 0 {
+		c.MaxWait = o.MaxWait
+	}
+	if o.PollStep > 0 {
+		c.PollStep = o.PollStep
+	}
+	if o.PollBackoff > 0 {
+		c.PollBackoff = o.PollBackoff
+	}
+	if o.MaxPollStep > 0 {
+		c.MaxPollStep = o.MaxPollStep
+	}
+	if o.Fallback != FallbackDefault {
+		c.Fallback = o.Fallback
+	}
+	return c
+}
+
+func (c LSNWaitConfig) withDefaults() LSNWaitConfig {
+	return LSNWaitConfig{
+		MaxWait:     defaultLSNWait,
+		PollStep:    defaultLSNPollStep,
+		PollBackoff: 1,
+		MaxPollStep: defaultMaxPollStep,
+		Fallback:    FallbackToPrimary,
+	}.merge(c)
+}
+
+// nextStep returns the poll step following step.
+func (c LSNWaitConfig) nextStep(step time.Duration) time.Duration {
+	if c.PollBackoff <= 1 {
+		return step
+	}
+
+	next := time.Duration(float64(step) * c.PollBackoff)
+	if next > c.MaxPollStep {
+		next = c.MaxPollStep
+	}
+	return next
+}
+
+type lsnWaitContextKey struct{}
+
+// WithLSNWait returns a child context overriding the provider
+// LSNWaitConfig for GetSecondary calls made with it.
+// Zero fields of cfg keep the provider values.
+func WithLSNWait(ctx context.Context, cfg LSNWaitConfig) context.Context {
+	return context.WithValue(ctx, lsnWaitContextKey{}, cfg)
+}
+
+// lsnWait returns the wait settings for a call made with ctx.
+func (p *Provider) lsnWait(ctx context.Context) LSNWaitConfig {
+	c := p.wait.withDefaults()
+	if o, ok := ctx.Value(lsnWaitContextKey{}).(LSNWaitConfig); ok {
+		c = c.merge(o)
+	}
+	return c
+}
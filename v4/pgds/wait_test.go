@@ -0,0 +1,189 @@
+package pgds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+func TestLSNWaitConfigDefaultsAndOverrides(t *testing.T) {
+	p := &Provider{wait: LSNWaitConfig{MaxWait: time.Second, Fallback: FallbackError}}
+
+	got := p.lsnWait(context.Background())
+	want := LSNWaitConfig{
+		MaxWait:     time.Second,
+		PollStep:    defaultLSNPollStep,
+		PollBackoff: 1,
+		MaxPollStep: defaultMaxPollStep,
+		Fallback:    FallbackError,
+	}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	ctx := WithLSNWait(context.Background(), LSNWaitConfig{PollStep: time.Millisecond, Fallback: FallbackWait})
+	got = p.lsnWait(ctx)
+	if got.MaxWait != time.Second || got.PollStep != time.Millisecond || got.Fallback != FallbackWait {
+		t.Fatalf("unexpected merged config: %+v", got)
+	}
+
+	ctx = WithLSNWait(context.Background(), LSNWaitConfig{MaxWait: NoLSNWait})
+	if got = p.lsnWait(ctx); got.MaxWait != NoLSNWait {
+		t.Fatalf("expected NoLSNWait to override the provider, got %v", got.MaxWait)
+	}
+}
+
+func TestGetSecondaryNoLSNWait(t *testing.T) {
+	p := laggingProvider(t, LSNWaitConfig{MaxWait: time.Minute, Fallback: FallbackError})
+
+	checks := 0
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		checks++
+		return false, nil
+	}
+
+	ctx := WithLSNWait(context.Background(), LSNWaitConfig{MaxWait: NoLSNWait})
+	start := time.Now()
+	_, _, err := p.GetSecondary(ctx, "0/10")
+	if !errors.Is(err, ds.ErrReplicaNotCaughtUp) {
+		t.Fatalf("expected ErrReplicaNotCaughtUp, got %v", err)
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Fatalf("expected no wait, waited %v", waited)
+	}
+	if checks != 1 {
+		t.Fatalf("expected replicas to be checked once, got %d checks", checks)
+	}
+
+	// A replica already at the LSN is still used.
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		return true, nil
+	}
+	pc, id, err := p.GetSecondary(ctx, "0/10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != "replica1" {
+		t.Fatalf("expected replica1, got %s", id)
+	}
+}
+
+func TestLSNWaitBackoff(t *testing.T) {
+	c := LSNWaitConfig{PollBackoff: 2, MaxPollStep: 300 * time.Millisecond}
+
+	step := 100 * time.Millisecond
+	step = c.nextStep(step)
+	if step != 200*time.Millisecond {
+		t.Fatalf("expected 200ms, got %v", step)
+	}
+	if step = c.nextStep(step); step != 300*time.Millisecond {
+		t.Fatalf("expected step capped at 300ms, got %v", step)
+	}
+
+	if got := (LSNWaitConfig{}).nextStep(step); got != step {
+		t.Fatalf("expected constant step without backoff, got %v", got)
+	}
+}
+
+func laggingProvider(t *testing.T, wait LSNWaitConfig) *Provider {
+	t.Helper()
+
+	orig := replicaHasLSNFn
+	t.Cleanup(func() { replicaHasLSNFn = orig })
+	replicaHasLSNFn = func(context.Context, ds.Conn, string) (bool, error) {
+		return false, nil
+	}
+
+	return &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": &fakeDB{},
+		},
+		wait: wait,
+	}
+}
+
+func TestGetSecondaryFallbackError(t *testing.T) {
+	p := laggingProvider(t, LSNWaitConfig{
+		MaxWait:  10 * time.Millisecond,
+		PollStep: time.Millisecond,
+		Fallback: FallbackError,
+	})
+
+	_, _, err := p.GetSecondary(context.Background(), "0/10")
+	if !errors.Is(err, ds.ErrReplicaNotCaughtUp) {
+		t.Fatalf("expected ErrReplicaNotCaughtUp, got %v", err)
+	}
+
+	st := p.Stats()
+	if st.LSNWaitTimeouts != 1 || st.PrimaryFallbacks != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	// A call may still opt into the primary.
+	ctx := WithLSNWait(context.Background(), LSNWaitConfig{Fallback: FallbackToPrimary})
+	pc, id, err := p.GetSecondary(ctx, "0/10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != PrimaryID {
+		t.Fatalf("expected primary, got %s", id)
+	}
+}
+
+func TestGetSecondaryFallbackWaitUsesContextDeadline(t *testing.T) {
+	p := laggingProvider(t, LSNWaitConfig{
+		MaxWait:  time.Millisecond,
+		PollStep: time.Millisecond,
+		Fallback: FallbackWait,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := p.GetSecondary(ctx, "0/10")
+	if !errors.Is(err, ds.ErrReplicaNotCaughtUp) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ErrReplicaNotCaughtUp and DeadlineExceeded, got %v", err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Fatalf("expected to wait for the context deadline, waited %v", waited)
+	}
+}
+
+func TestTrackedGetSecondaryFallbackWait(t *testing.T) {
+	stubReplayLSN(t)
+
+	replica := &lsnDB{}
+	p := &Provider{
+		primary: &fakeDB{},
+		secondaries: map[ds.ServerID]dbHandle{
+			"replica1": replica,
+		},
+		wait: LSNWaitConfig{MaxWait: time.Millisecond, Fallback: FallbackWait},
+	}
+	p.startLSNTracker(5 * time.Millisecond)
+	defer p.Close()
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		replica.lsn.Store(0x10)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pc, id, err := p.GetSecondary(ctx, "0/10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.Release()
+	if id != "replica1" {
+		t.Fatalf("expected replica1, got %s", id)
+	}
+}
@@ -0,0 +1,123 @@
+package ds
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryClassifier is implemented by connections that can tell whether
+// a failed transaction may succeed when run again, such as after a
+// serialization failure or a deadlock.
+type RetryClassifier interface {
+	IsRetryable(err error) bool
+}
+
+// IsRetryable reports whether err is classified as a serialization
+// failure or a deadlock, after which the transaction may be run again.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock)
+}
+
+// RetryPolicy configures WithTxRetry. Zero fields take defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the transaction is run,
+	// including the first one. Default 3.
+	MaxAttempts int
+	// InitialBackoff is the upper bound of the delay before the first
+	// retry. It doubles with every retry up to MaxBackoff; the actual
+	// delay is picked at random below the bound. Default 10ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay bound. Default 1s.
+	MaxBackoff time.Duration
+	// Retryable classifies errors instead of the connection.
+	// If nil, the RetryClassifier of the connection is used, and
+	// without one IsRetryable.
+	Retryable func(err error) bool
+	// OnRetry, if set, is called before sleeping ahead of a retry
+	// with the number of the failed attempt and its error.
+	OnRetry func(attempt int, err error)
+}
+
+const (
+	defaultRetryAttempts       = 3
+	defaultRetryInitialBackoff = 10 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+)
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	return p
+}
+
+// backoff returns the delay before retry n, counted from 1.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	bound := p.InitialBackoff
+	for i := 1; i < n && bound < p.MaxBackoff; i++ {
+		bound *= 2
+	}
+	bound = min(bound, p.MaxBackoff)
+
+	return rand.N(bound) + 1
+}
+
+// WithTxRetry runs fn in a transaction started with opts like
+// WithTxOptions and runs it again while it fails with a retryable error,
+// up to policy.MaxAttempts times. fn must be safe to run more than once.
+//
+// Errors are classified by policy.Retryable, else by the RetryClassifier
+// of conn, found through wrappers implementing Unwrap() Conn, else by
+// IsRetryable. The last error is returned once attempts are exhausted;
+// the context error is returned if ctx is done while waiting for a retry.
+//
+//	err := ds.WithTxRetry(ctx, conn, ds.TxOptions{
+//		Isolation: ds.IsolationSerializable,
+//	}, ds.RetryPolicy{MaxAttempts: 5}, transfer)
+func WithTxRetry(
+	ctx context.Context,
+	conn Conn,
+	opts TxOptions,
+	policy RetryPolicy,
+	fn func(ctx context.Context, tx Tx) error,
+) error {
+	policy = policy.withDefaults()
+
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+		if c, ok := findConn[RetryClassifier](conn); ok {
+			retryable = c.IsRetryable
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := WithTxOptions(ctx, conn, opts, fn)
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err)
+		}
+
+		t := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package ds_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+var errSerialization = errors.New("could not serialize access")
+
+// retryConn classifies errSerialization as retryable.
+type retryConn struct {
+	ds.Conn
+}
+
+func (retryConn) IsRetryable(err error) bool {
+	return errors.Is(err, errSerialization)
+}
+
+func TestWithTxRetryRetriesRetryableErrors(t *testing.T) {
+	opts := ds.TxOptions{Isolation: ds.IsolationSerializable}
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin().WithOptions(opts)
+	p.ExpectExec(`UPDATE`).WillReturnError(errSerialization)
+	p.ExpectRollback()
+	p.ExpectBegin().WithOptions(opts)
+	p.ExpectExec(`UPDATE`)
+	p.ExpectCommit().WillReturnError(errSerialization)
+	p.ExpectRollback()
+	p.ExpectBegin().WithOptions(opts)
+	p.ExpectExec(`UPDATE`)
+	p.ExpectCommit()
+
+	pc, id, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	// The classifier is found behind hook wrappers.
+	conn := ds.WithHooks(poolConnOf(pc, retryConn{pc.Conn()}), id, ds.HookFuncs{}).Conn()
+
+	var retries []int
+	policy := ds.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		OnRetry: func(attempt int, err error) {
+			retries = append(retries, attempt)
+		},
+	}
+
+	err = ds.WithTxRetry(context.Background(), conn, opts, policy, func(ctx context.Context, tx ds.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE accounts SET balance = balance - 1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+		t.Fatalf("expected retries after attempts 1 and 2, got %v", retries)
+	}
+}
+
+func TestWithTxRetryGivesUp(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectRollback()
+	p.ExpectBegin()
+	p.ExpectRollback()
+
+	conn := retryConn{primaryConn(t, p)}
+	policy := ds.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+
+	calls := 0
+	err := ds.WithTxRetry(context.Background(), conn, ds.TxOptions{}, policy, func(context.Context, ds.Tx) error {
+		calls++
+		return errSerialization
+	})
+	if !errors.Is(err, errSerialization) {
+		t.Fatalf("expected last error, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestWithTxRetryDoesNotRetryOtherErrors(t *testing.T) {
+	expectedErr := errors.New("insufficient funds")
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectRollback()
+
+	conn := retryConn{primaryConn(t, p)}
+
+	err := ds.WithTxRetry(context.Background(), conn, ds.TxOptions{}, ds.RetryPolicy{}, func(context.Context, ds.Tx) error {
+		return expectedErr
+	})
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+}
+
+func TestWithTxRetryPolicyClassifier(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectRollback()
+	p.ExpectBegin()
+	p.ExpectCommit()
+
+	// The connection has no classifier of its own.
+	conn := primaryConn(t, p)
+	policy := ds.RetryPolicy{
+		InitialBackoff: time.Millisecond,
+		Retryable: func(err error) bool {
+			return errors.Is(err, errSerialization)
+		},
+	}
+
+	calls := 0
+	err := ds.WithTxRetry(context.Background(), conn, ds.TxOptions{}, policy, func(context.Context, ds.Tx) error {
+		calls++
+		if calls == 1 {
+			return errSerialization
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWithTxRetryStopsOnCancel(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectRollback()
+
+	conn := retryConn{primaryConn(t, p)}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	policy := ds.RetryPolicy{
+		InitialBackoff: time.Hour,
+		OnRetry:        func(int, error) { cancel() },
+	}
+
+	err := ds.WithTxRetry(ctx, conn, ds.TxOptions{}, policy, func(context.Context, ds.Tx) error {
+		return errSerialization
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package ds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrInvalidSavepointName = errors.New("ds: invalid savepoint name")
+
+// BeginSavepoint starts a nested transaction on q, usually the enclosing
+// Tx, by executing SAVEPOINT name. Commit releases the savepoint, Rollback
+// rolls back to it and releases it. Providers whose driver has no native
+// nesting use it to implement Tx.Begin; name must be unique among the
+// open savepoints of the transaction.
+//
+// name is written into the SQL as is, so it must be a plain identifier
+// of ASCII letters, digits and underscores not starting with a digit;
+// other names fail with ErrInvalidSavepointName.
+func BeginSavepoint(ctx context.Context, q Querier, name string) (Tx, error) {
+	if !isPlainIdentifier(name) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSavepointName, name)
+	}
+	if _, err := q.Exec(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+
+	return &savepointTx{q: q, name: name}, nil
+}
+
+type savepointTx struct {
+	q    Querier
+	name string
+
+	mu       sync.Mutex
+	done     bool
+	children int
+}
+
+var _ Tx = (*savepointTx)(nil)
+
+func (t *savepointTx) Exec(ctx context.Context, sql string, args ...any) (ExecResult, error) {
+	if t.isDone() {
+		return nil, ErrTxDone
+	}
+	return t.q.Exec(ctx, sql, args...)
+}
+
+func (t *savepointTx) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	if t.isDone() {
+		return nil, ErrTxDone
+	}
+	return t.q.Query(ctx, sql, args...)
+}
+
+func (t *savepointTx) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	if t.isDone() {
+		return errRow{err: ErrTxDone}
+	}
+	return t.q.QueryRow(ctx, sql, args...)
+}
+
+// SendBatch runs the batch statement by statement inside the savepoint.
+func (t *savepointTx) SendBatch(ctx context.Context, b *Batch) BatchResults {
+	return SendBatchSequential(ctx, t, b)
+}
+
+func (t *savepointTx) InsertOptions() InsertOptions {
+	return insertOptionsOf(t.q)
+}
+
+func (t *savepointTx) Begin(ctx context.Context) (Tx, error) {
+	t.mu.Lock()
+	if t.done {
+		t.mu.Unlock()
+		return nil, ErrTxDone
+	}
+	t.children++
+	name := fmt.Sprintf("%s_%d", t.name, t.children)
+	t.mu.Unlock()
+
+	return BeginSavepoint(ctx, t, name)
+}
+
+func (t *savepointTx) Commit(ctx context.Context) error {
+	if t.isDone() {
+		return ErrTxDone
+	}
+
+	if _, err := t.q.Exec(ctx, "RELEASE SAVEPOINT "+t.name); err != nil {
+		return err
+	}
+
+	t.finish()
+	return nil
+}
+
+func (t *savepointTx) Rollback(ctx context.Context) error {
+	if t.isDone() {
+		return ErrTxDone
+	}
+
+	if _, err := t.q.Exec(ctx, "ROLLBACK TO SAVEPOINT "+t.name); err != nil {
+		return err
+	}
+	if _, err := t.q.Exec(ctx, "RELEASE SAVEPOINT "+t.name); err != nil {
+		return err
+	}
+
+	t.finish()
+	return nil
+}
+
+// isPlainIdentifier reports whether s matches [A-Za-z_][A-Za-z0-9_]*.
+func isPlainIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (t *savepointTx) isDone() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.done
+}
+
+func (t *savepointTx) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done = true
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
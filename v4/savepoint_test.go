@@ -0,0 +1,154 @@
+package ds_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+func TestBeginSavepoint(t *testing.T) {
+	ctx := context.Background()
+	expectedErr := errors.New("inner failed")
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectExec(`^SAVEPOINT sp$`)
+	p.ExpectExec(`^SAVEPOINT sp_1$`)
+	p.ExpectExec(`INSERT`)
+	p.ExpectExec(`^SAVEPOINT sp_1_1$`)
+	p.ExpectExec(`^ROLLBACK TO SAVEPOINT sp_1_1$`)
+	p.ExpectExec(`^RELEASE SAVEPOINT sp_1_1$`)
+	p.ExpectExec(`^ROLLBACK TO SAVEPOINT sp_1$`)
+	p.ExpectExec(`^RELEASE SAVEPOINT sp_1$`)
+	p.ExpectExec(`^RELEASE SAVEPOINT sp$`)
+	p.ExpectCommit()
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	err = ds.WithTx(ctx, pc.Conn(), func(ctx context.Context, tx ds.Tx) error {
+		sp, err := ds.BeginSavepoint(ctx, tx, "sp")
+		if err != nil {
+			return err
+		}
+
+		err = ds.WithTx(ctx, sp, func(ctx context.Context, tx ds.Tx) error {
+			_, err := tx.Exec(ctx, "INSERT INTO users(name) VALUES($1)", "alice")
+			if err != nil {
+				return err
+			}
+
+			return ds.WithTx(ctx, tx, func(context.Context, ds.Tx) error {
+				return expectedErr
+			})
+		})
+		if !errors.Is(err, expectedErr) {
+			t.Fatalf("expected %v, got %v", expectedErr, err)
+		}
+
+		return sp.Commit(ctx)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSavepointDone(t *testing.T) {
+	ctx := context.Background()
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectExec(`^SAVEPOINT sp$`)
+	p.ExpectExec(`^RELEASE SAVEPOINT sp$`)
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	sp, err := ds.BeginSavepoint(ctx, pc.Conn(), "sp")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sp.Commit(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := sp.Rollback(ctx); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, got %v", err)
+	}
+	if _, err := sp.Exec(ctx, "DELETE FROM users"); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, got %v", err)
+	}
+	if err := sp.QueryRow(ctx, "SELECT 1").Scan(); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, got %v", err)
+	}
+	if _, err := sp.Begin(ctx); !errors.Is(err, ds.ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, got %v", err)
+	}
+}
+
+func TestSavepointRejectsInvalidName(t *testing.T) {
+	ctx := context.Background()
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	conn := primaryConn(t, p)
+
+	for _, name := range []string{"", "1sp", "sp-1", "sp; DROP TABLE users", `"sp"`, "spé"} {
+		if _, err := ds.BeginSavepoint(ctx, conn, name); !errors.Is(err, ds.ErrInvalidSavepointName) {
+			t.Fatalf("BeginSavepoint(%q): expected ErrInvalidSavepointName, got %v", name, err)
+		}
+	}
+}
+
+func TestWithHooksNestedTx(t *testing.T) {
+	ctx := context.Background()
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectBegin()
+	p.ExpectRollback()
+	p.ExpectCommit()
+
+	var log []string
+	h := &recordingHook{name: "h", log: &log}
+	conn := hookedConn(t, p, h)
+
+	err := ds.WithTx(ctx, conn, func(ctx context.Context, tx ds.Tx) error {
+		_ = ds.WithTx(ctx, tx, func(context.Context, ds.Tx) error {
+			return errors.New("rolled back")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		op     ds.Op
+		nested bool
+	}{
+		{ds.OpBegin, false},
+		{ds.OpBegin, true},
+		{ds.OpRollback, true},
+		{ds.OpCommit, false},
+	}
+	if len(h.events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(h.events))
+	}
+	for i, w := range want {
+		if ev := h.events[i]; ev.Op != w.op || ev.Nested != w.nested {
+			t.Fatalf("event %d: expected %s nested=%v, got %s nested=%v", i, w.op, w.nested, ev.Op, ev.Nested)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package ds
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrColumnMismatch = errors.New("ds: result columns do not match struct fields")
+
+// ScanStruct scans the current row of rows into the struct dest points
+// to, matching columns to fields by name.
+//
+// A field's column name is its `db` tag, or the field name if it has
+// none; `db:"-"` skips the field. Names match case-insensitively.
+// Fields of embedded structs without a tag are matched as if they
+// belonged to the outer struct. Every column must match a field
+// and every field a column, otherwise ErrColumnMismatch is returned.
+func ScanStruct(rows Rows, dest any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ds: ScanStruct needs a non-nil pointer to a struct, got %T", dest)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	plan, err := planStruct(v.Elem().Type(), columns)
+	if err != nil {
+		return err
+	}
+
+	return plan.scan(rows, v.Elem())
+}
+
+// CollectRows reads all rows into a slice and closes rows.
+// Struct types are scanned like ScanStruct; other types, such as
+// int64 or time.Time, from a single column.
+//
+//	rows, err := conn.Query(ctx, "SELECT id, name FROM users")
+//	if err != nil {
+//		return err
+//	}
+//	users, err := ds.CollectRows[User](rows)
+func CollectRows[T any](rows Rows) ([]T, error) {
+	defer rows.Close()
+
+	scan, err := rowScanner[T](rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []T{}
+	for rows.Next() {
+		var v T
+		if err := scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, rows.Close()
+}
+
+// CollectOne reads the first row like CollectRows and closes rows.
+// It returns ErrNoRows if there is none; further rows are discarded.
+func CollectOne[T any](rows Rows) (T, error) {
+	defer rows.Close()
+
+	var v T
+	scan, err := rowScanner[T](rows)
+	if err != nil {
+		return v, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return v, err
+		}
+		return v, ErrNoRows
+	}
+	if err := scan(&v); err != nil {
+		return v, err
+	}
+
+	return v, rows.Close()
+}
+
+// rowScanner returns the function scanning a row of rows into a T.
+func rowScanner[T any](rows Rows) (func(*T) error, error) {
+	t := reflect.TypeFor[T]()
+	if !isStructRow(t) {
+		return func(dest *T) error {
+			return rows.Scan(dest)
+		}, nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planStruct(t, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(dest *T) error {
+		return plan.scan(rows, reflect.ValueOf(dest).Elem())
+	}, nil
+}
+
+var (
+	scannerType = reflect.TypeFor[interface{ Scan(src any) error }]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// isStructRow reports whether t is scanned field by field rather
+// than as a single value.
+func isStructRow(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct &&
+		t != timeType &&
+		!reflect.PointerTo(t).Implements(scannerType)
+}
+
+// structPlan holds the field index path for each result column.
+type structPlan [][]int
+
+func (p structPlan) scan(rows Rows, v reflect.Value) error {
+	dest := make([]any, len(p))
+	for i, index := range p {
+		dest[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+	return rows.Scan(dest...)
+}
+
+func planStruct(t reflect.Type, columns []string) (structPlan, error) {
+	fields := structFieldsOf(t)
+
+	plan := make(structPlan, len(columns))
+	used := make(map[string]bool, len(columns))
+	for i, col := range columns {
+		key := strings.ToLower(col)
+		f, ok := fields.byName[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: column %q has no field in %s", ErrColumnMismatch, col, t)
+		}
+		if used[key] {
+			return nil, fmt.Errorf("%w: column %q appears more than once", ErrColumnMismatch, col)
+		}
+		used[key] = true
+		plan[i] = f.index
+	}
+
+	for _, f := range fields.list {
+		if !used[f.column] {
+			return nil, fmt.Errorf("%w: field %s.%s has no column %q", ErrColumnMismatch, t, f.name, f.column)
+		}
+	}
+
+	return plan, nil
+}
+
+type structField struct {
+	name   string
+	column string
+	index  []int
+}
+
+type structFields struct {
+	list   []*structField
+	byName map[string]*structField
+}
+
+var structFieldsCache sync.Map // reflect.Type -> *structFields
+
+func structFieldsOf(t reflect.Type) *structFields {
+	if fs, ok := structFieldsCache.Load(t); ok {
+		return fs.(*structFields)
+	}
+
+	fs := &structFields{byName: make(map[string]*structField)}
+	collectFields(fs, t, nil)
+
+	actual, _ := structFieldsCache.LoadOrStore(t, fs)
+	return actual.(*structFields)
+}
+
+// collectFields adds the fields of t to fs. Direct fields are added
+// before those of embedded structs, so they win on name conflicts.
+func collectFields(fs *structFields, t reflect.Type, index []int) {
+	var embedded []reflect.StructField
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+		// Exported fields of unexported embedded structs are settable.
+		if f.Anonymous && !hasTag && isStructRow(f.Type) {
+			embedded = append(embedded, f)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		column := tag
+		if column == "" {
+			column = f.Name
+		}
+		column = strings.ToLower(column)
+		if _, ok := fs.byName[column]; ok {
+			continue
+		}
+
+		sf := &structField{
+			name:   f.Name,
+			column: column,
+			index:  append(append([]int(nil), index...), i),
+		}
+		fs.list = append(fs.list, sf)
+		fs.byName[column] = sf
+	}
+
+	for _, f := range embedded {
+		collectFields(fs, f.Type, append(append([]int(nil), index...), f.Index...))
+	}
+}
@@ -0,0 +1,149 @@
+package ds_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+type audit struct {
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type user struct {
+	ID    int64 `db:"id"`
+	Name  string
+	Email *string `db:"email"`
+	Notes string  `db:"-"`
+	audit
+}
+
+func query(t *testing.T, rows *dstest.Rows) ds.Rows {
+	t.Helper()
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectQuery(`^SELECT`).WillReturnRows(rows)
+
+	r, err := primaryConn(t, p).Query(context.Background(), "SELECT")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return r
+}
+
+func TestCollectRows(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	email := "alice@example.com"
+
+	rows := query(t, dstest.NewRows("id", "name", "email", "created_at").
+		AddRow(int64(1), "alice", email, created).
+		AddRow(int64(2), "bob", nil, created))
+
+	users, err := ds.CollectRows[user](rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+	if u := users[0]; u.ID != 1 || u.Name != "alice" || u.Email == nil || *u.Email != email || !u.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected first user %+v", u)
+	}
+	if u := users[1]; u.ID != 2 || u.Name != "bob" || u.Email != nil {
+		t.Fatalf("unexpected second user %+v", u)
+	}
+}
+
+func TestCollectRowsEmpty(t *testing.T) {
+	users, err := ds.CollectRows[user](query(t, dstest.NewRows("id", "name", "email", "created_at")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if users == nil || len(users) != 0 {
+		t.Fatalf("expected an empty slice, got %#v", users)
+	}
+}
+
+func TestCollectRowsScalar(t *testing.T) {
+	ids, err := ds.CollectRows[int64](query(t, dstest.NewRows("id").AddRow(int64(3)).AddRow(int64(5))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 3 || ids[1] != 5 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+}
+
+func TestCollectRowsColumnMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+	}{
+		{"extra column", []string{"id", "name", "email", "created_at", "age"}},
+		{"missing column", []string{"id", "name", "email"}},
+		{"duplicate column", []string{"id", "name", "email", "created_at", "ID"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ds.CollectRows[user](query(t, dstest.NewRows(tt.columns...)))
+			if !errors.Is(err, ds.ErrColumnMismatch) {
+				t.Fatalf("expected ErrColumnMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCollectRowsRowError(t *testing.T) {
+	expectedErr := errors.New("connection reset")
+
+	rows := query(t, dstest.NewRows("id").AddRow(int64(1)).RowError(1, expectedErr))
+	if _, err := ds.CollectRows[int64](rows); !errors.Is(err, expectedErr) {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+}
+
+func TestCollectOne(t *testing.T) {
+	rows := query(t, dstest.NewRows("id", "name", "email", "created_at").
+		AddRow(int64(1), "alice", nil, time.Time{}).
+		AddRow(int64(2), "bob", nil, time.Time{}))
+
+	u, err := ds.CollectOne[user](rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.ID != 1 || u.Name != "alice" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+
+	_, err = ds.CollectOne[user](query(t, dstest.NewRows("id", "name", "email", "created_at")))
+	if !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestScanStruct(t *testing.T) {
+	rows := query(t, dstest.NewRows("ID", "name", "email", "created_at").
+		AddRow(int64(7), "carol", nil, time.Time{}))
+	defer rows.Close()
+
+	if !rows.Next() {
+		t.Fatal("expected a row")
+	}
+	var u user
+	if err := ds.ScanStruct(rows, &u); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.ID != 7 || u.Name != "carol" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+
+	if err := ds.ScanStruct(rows, u); err == nil {
+		t.Fatal("expected an error for a non-pointer destination")
+	}
+}
@@ -0,0 +1,739 @@
+// Package sqlds implements a data storage provider on top of
+// database/sql. It works with any registered driver and supports
+// one primary and optional secondary databases.
+package sqlds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dronm/ds/v4"
+)
+
+const (
+	ProviderID = "sql"
+	PrimaryID  = ds.ServerID("primary")
+)
+
+//
+// ---------- Config ----------
+//
+
+type Config struct {
+	// DriverName is the registered database/sql driver name.
+	DriverName string
+	// PrimaryDSN is the data source name of the primary database.
+	PrimaryDSN string
+	// Secondaries maps replica IDs to their data source names.
+	Secondaries map[ds.ServerID]string
+
+	Options
+}
+
+// Options configures a Provider independently of how
+// its databases are opened.
+type Options struct {
+	// Hooks observe every operation on leased connections.
+	Hooks []ds.Hook
+	// Logger receives records about acquisitions and routing
+	// decisions and, through ds.NewLogHook, about queries.
+	// Nil disables logging.
+	Logger *slog.Logger
+	// LogOptions configures query records written to Logger.
+	LogOptions ds.LogOptions
+	// IsRetryable classifies errors for ds.WithTxRetry.
+	// Nil uses ds.IsRetryable.
+	IsRetryable func(err error) bool
+	// ClassifyError maps driver errors returned by connections,
+	// usually to a *ds.Error. Nil returns them unchanged.
+	ClassifyError func(err error) error
+	// Insert configures the INSERT statements ds.CopyFrom falls back to.
+	// Open fills a nil Placeholder or QuoteIdentifier with the style of
+	// DriverName for drivers known not to accept $N or "name".
+	Insert ds.InsertOptions
+}
+
+// driverInsertOptions are the placeholder and quoting styles of drivers
+// that differ from the ds.InsertOptions defaults.
+var driverInsertOptions = map[string]ds.InsertOptions{
+	"mysql": {
+		Placeholder:     ds.QuestionPlaceholder,
+		QuoteIdentifier: ds.BacktickIdentifier,
+	},
+	"sqlserver": {
+		Placeholder:     atPlaceholder,
+		QuoteIdentifier: ds.BracketIdentifier,
+	},
+	"mssql": {
+		Placeholder:     atPlaceholder,
+		QuoteIdentifier: ds.BracketIdentifier,
+	},
+}
+
+func atPlaceholder(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+// insertOptions fills the unset styles of opts from driverInsertOptions.
+func insertOptions(driverName string, opts ds.InsertOptions) ds.InsertOptions {
+	d := driverInsertOptions[driverName]
+	if opts.Placeholder == nil {
+		opts.Placeholder = d.Placeholder
+	}
+	if opts.QuoteIdentifier == nil {
+		opts.QuoteIdentifier = d.QuoteIdentifier
+	}
+	return opts
+}
+
+//
+// ---------- Provider registration ----------
+//
+
+func init() {
+	ds.Register(ProviderID, New)
+}
+
+func New(cfg any) (ds.Provider, error) {
+	c, ok := cfg.(*Config)
+	if !ok {
+		return nil, errors.New("sqlds: config must be *sqlds.Config")
+	}
+
+	return Open(c)
+}
+
+// Open opens the primary and secondary databases described by c.
+func Open(c *Config) (*Provider, error) {
+	if c == nil {
+		return nil, errors.New("sqlds: config is nil")
+	}
+	if c.DriverName == "" {
+		return nil, errors.New("sqlds: DriverName is required")
+	}
+	if c.PrimaryDSN == "" {
+		return nil, errors.New("sqlds: PrimaryDSN is required")
+	}
+
+	primary, err := sql.Open(c.DriverName, c.PrimaryDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	secondaries := make(map[ds.ServerID]*sql.DB, len(c.Secondaries))
+	for id, dsn := range c.Secondaries {
+		sdb, err := sql.Open(c.DriverName, dsn)
+		if err != nil {
+			_ = primary.Close()
+			for _, s := range secondaries {
+				_ = s.Close()
+			}
+			return nil, fmt.Errorf("sqlds: secondary %s: %w", id, err)
+		}
+		secondaries[id] = sdb
+	}
+
+	opts := c.Options
+	opts.Insert = insertOptions(c.DriverName, opts.Insert)
+
+	return NewWithDB(primary, secondaries, opts), nil
+}
+
+// NewWithDB adapts already opened databases. The provider takes
+// ownership of them and closes them in Close.
+func NewWithDB(
+	primary *sql.DB,
+	secondaries map[ds.ServerID]*sql.DB,
+	opts Options,
+) *Provider {
+	p := &Provider{
+		primary:         primary,
+		secondaries:     make(map[ds.ServerID]*sql.DB, len(secondaries)),
+		secondaryServed: make(map[ds.ServerID]*atomic.Int64, len(secondaries)),
+		hooks:           opts.Hooks,
+		logger:          opts.Logger,
+		retryable:       opts.IsRetryable,
+		classify:        opts.ClassifyError,
+		insert:          opts.Insert,
+	}
+	if p.logger == nil {
+		p.logger = slog.New(slog.DiscardHandler)
+	} else {
+		p.hooks = append(append([]ds.Hook(nil), opts.Hooks...), ds.NewLogHook(opts.Logger, opts.LogOptions))
+	}
+
+	for id, sdb := range secondaries {
+		p.secondaries[id] = sdb
+		p.secondaryIDs = append(p.secondaryIDs, id)
+		p.secondaryServed[id] = &atomic.Int64{}
+	}
+	sort.Slice(p.secondaryIDs, func(i, j int) bool {
+		return p.secondaryIDs[i] < p.secondaryIDs[j]
+	})
+
+	return p
+}
+
+//
+// ---------- Provider ----------
+//
+
+type Provider struct {
+	primary      *sql.DB
+	secondaries  map[ds.ServerID]*sql.DB
+	secondaryIDs []ds.ServerID
+	next         atomic.Uint64
+	hooks        []ds.Hook
+	logger       *slog.Logger
+	retryable    func(err error) bool
+	classify     classifier
+	insert       ds.InsertOptions
+
+	secondaryServed  map[ds.ServerID]*atomic.Int64
+	primaryFallbacks atomic.Int64
+}
+
+var _ ds.Provider = (*Provider)(nil)
+
+// PrimaryDB returns the primary database handle.
+func (p *Provider) PrimaryDB() *sql.DB {
+	return p.primary
+}
+
+// SecondaryDB returns the secondary database handle with the given id.
+func (p *Provider) SecondaryDB(id ds.ServerID) (*sql.DB, bool) {
+	sdb, ok := p.secondaries[id]
+	return sdb, ok
+}
+
+func (p *Provider) GetPrimary(
+	ctx context.Context,
+) (ds.PoolConn, ds.ServerID, error) {
+	c, err := p.primary.Conn(ctx)
+	if err != nil {
+		p.logger.WarnContext(ctx, "sqlds: acquire failed",
+			slog.String("server", string(PrimaryID)),
+			slog.Any("error", err),
+		)
+		return nil, "", err
+	}
+
+	return ds.WithHooks(p.wrapPoolConn(c), PrimaryID, p.hooks...), PrimaryID, nil
+}
+
+// GetSecondary returns a connection to a secondary, picking replicas
+// in round-robin order and skipping the ones that cannot be reached.
+//
+// database/sql has no portable notion of a replication position, so
+// a non-empty minLSN is served by the primary, as is the case when no
+// secondary is available.
+func (p *Provider) GetSecondary(
+	ctx context.Context,
+	minLSN string,
+) (ds.PoolConn, ds.ServerID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if minLSN != "" || len(p.secondaryIDs) == 0 {
+		return p.GetPrimary(ctx)
+	}
+
+	n := uint64(len(p.secondaryIDs))
+	start := p.next.Add(1) - 1
+
+	for i := uint64(0); i < n; i++ {
+		id := p.secondaryIDs[(start+i)%n]
+
+		c, err := p.secondaries[id].Conn(ctx)
+		if err == nil {
+			p.secondaryServed[id].Add(1)
+			return ds.WithHooks(p.wrapPoolConn(c), id, p.hooks...), id, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, "", ctxErr
+		}
+
+		p.logger.WarnContext(ctx, "sqlds: acquire failed",
+			slog.String("server", string(id)),
+			slog.Any("error", err),
+		)
+	}
+
+	p.primaryFallbacks.Add(1)
+	p.logger.WarnContext(ctx, "sqlds: no secondary available, falling back to primary")
+
+	return p.GetPrimary(ctx)
+}
+
+func (p *Provider) Release(pc ds.PoolConn, _ ds.ServerID) {
+	if pc != nil {
+		pc.Release()
+	}
+}
+
+func (p *Provider) Close() error {
+	err := p.primary.Close()
+	for _, s := range p.secondaries {
+		if sErr := s.Close(); sErr != nil && err == nil {
+			err = sErr
+		}
+	}
+	return err
+}
+
+//
+// ---------- PoolConn ----------
+//
+
+type poolConn struct {
+	mu   sync.Mutex
+	conn *sqlConn
+}
+
+func (p *Provider) wrapPoolConn(c *sql.Conn) ds.PoolConn {
+	return &poolConn{conn: &sqlConn{conn: c, retryable: p.retryable, classify: p.classify, insert: p.insert}}
+}
+
+func (p *poolConn) Conn() ds.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.conn
+}
+
+// Release closes statements prepared on the connection
+// and returns it to the pool. It is safe to call twice.
+func (p *poolConn) Release() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return
+	}
+
+	p.conn.closeStatements()
+	_ = p.conn.conn.Close()
+	p.conn = nil
+}
+
+//
+// ---------- Conn ----------
+//
+
+// classifier maps driver errors with Options.ClassifyError.
+type classifier func(err error) error
+
+// wrap maps err with the classifier. sql.ErrTxDone is also reported
+// as ds.ErrTxDone.
+func (c classifier) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrTxDone) && !errors.Is(err, ds.ErrTxDone) {
+		err = fmt.Errorf("%w: %w", ds.ErrTxDone, err)
+	}
+	if c == nil {
+		return err
+	}
+	return c(err)
+}
+
+// sqlConn adapts a leased *sql.Conn. database/sql does not check the
+// context of calls on a dedicated connection before running them,
+// so every method does it first.
+type sqlConn struct {
+	conn      *sql.Conn
+	retryable func(err error) bool
+	classify  classifier
+	insert    ds.InsertOptions
+
+	mu    sync.Mutex
+	stmts []*sql.Stmt
+}
+
+var (
+	_ ds.Conn            = (*sqlConn)(nil)
+	_ ds.RetryClassifier = (*sqlConn)(nil)
+	_ ds.InsertDialect   = (*sqlConn)(nil)
+)
+
+func (c *sqlConn) Exec(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (ds.ExecResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, err := c.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, c.classify.wrap(err)
+	}
+	return execResult{res: res}, nil
+}
+
+func (c *sqlConn) Query(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (ds.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := c.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, c.classify.wrap(err)
+	}
+	return &sqlRows{rows: rows, classify: c.classify}, nil
+}
+
+func (c *sqlConn) QueryRow(
+	ctx context.Context,
+	query string,
+	args ...any,
+) ds.Row {
+	if err := ctx.Err(); err != nil {
+		return &sqlRow{err: err}
+	}
+	return &sqlRow{row: c.conn.QueryRowContext(ctx, query, args...), classify: c.classify}
+}
+
+// Prepare prepares query on the leased connection. database/sql
+// statements are not named, name is only reported back by Name.
+func (c *sqlConn) Prepare(
+	ctx context.Context,
+	name string,
+	query string,
+) (ds.PreparedStatement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stmt, err := c.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, c.classify.wrap(err)
+	}
+
+	c.mu.Lock()
+	c.stmts = append(c.stmts, stmt)
+	c.mu.Unlock()
+
+	return &sqlPreparedStatement{
+		stmt:     stmt,
+		name:     name,
+		classify: c.classify,
+	}, nil
+}
+
+// SendBatch runs the batch statement by statement as results are read.
+// database/sql has no pipelining, so every statement is a round trip.
+func (c *sqlConn) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return ds.SendBatchSequential(ctx, c, b)
+}
+
+func (c *sqlConn) Begin(ctx context.Context) (ds.Tx, error) {
+	return c.BeginTx(ctx, ds.TxOptions{})
+}
+
+// BeginTx starts a transaction with opts. database/sql cannot express
+// deferrable transactions, so opts.Deferrable is rejected.
+func (c *sqlConn) BeginTx(ctx context.Context, opts ds.TxOptions) (ds.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	txOpts, err := sqlTxOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.conn.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, c.classify.wrap(err)
+	}
+
+	return &sqlTx{
+		tx:       tx,
+		classify: c.classify,
+		insert:   c.insert,
+	}, nil
+}
+
+// sqlTxOptions maps opts to sql.TxOptions, nil for the zero value.
+func sqlTxOptions(opts ds.TxOptions) (*sql.TxOptions, error) {
+	if opts.Deferrable {
+		return nil, errors.New("sqlds: deferrable transactions are not supported")
+	}
+	if opts == (ds.TxOptions{}) {
+		return nil, nil
+	}
+
+	txOpts := &sql.TxOptions{}
+
+	switch opts.Isolation {
+	case ds.IsolationDefault:
+		txOpts.Isolation = sql.LevelDefault
+	case ds.IsolationReadUncommitted:
+		txOpts.Isolation = sql.LevelReadUncommitted
+	case ds.IsolationReadCommitted:
+		txOpts.Isolation = sql.LevelReadCommitted
+	case ds.IsolationRepeatableRead:
+		txOpts.Isolation = sql.LevelRepeatableRead
+	case ds.IsolationSerializable:
+		txOpts.Isolation = sql.LevelSerializable
+	default:
+		return nil, fmt.Errorf("sqlds: unknown isolation level %d", opts.Isolation)
+	}
+
+	switch opts.AccessMode {
+	case ds.AccessDefault, ds.AccessReadWrite:
+	case ds.AccessReadOnly:
+		txOpts.ReadOnly = true
+	default:
+		return nil, fmt.Errorf("sqlds: unknown access mode %d", opts.AccessMode)
+	}
+
+	return txOpts, nil
+}
+
+// InsertOptions configures the ds.CopyFrom fallback, see Options.Insert.
+func (c *sqlConn) InsertOptions() ds.InsertOptions {
+	return c.insert
+}
+
+// IsRetryable classifies errors with Options.IsRetryable.
+func (c *sqlConn) IsRetryable(err error) bool {
+	if c.retryable == nil {
+		return ds.IsRetryable(err)
+	}
+	return c.retryable(err)
+}
+
+func (c *sqlConn) closeStatements() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, stmt := range c.stmts {
+		_ = stmt.Close()
+	}
+	c.stmts = nil
+}
+
+//
+// ---------- Prepared statement ----------
+//
+
+type sqlPreparedStatement struct {
+	stmt     *sql.Stmt
+	name     string
+	classify classifier
+}
+
+var _ ds.PreparedStatement = (*sqlPreparedStatement)(nil)
+
+func (s *sqlPreparedStatement) Exec(
+	ctx context.Context,
+	args ...any,
+) (ds.ExecResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, err := s.stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return nil, s.classify.wrap(err)
+	}
+	return execResult{res: res}, nil
+}
+
+func (s *sqlPreparedStatement) Query(
+	ctx context.Context,
+	args ...any,
+) (ds.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := s.stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, s.classify.wrap(err)
+	}
+	return &sqlRows{rows: rows, classify: s.classify}, nil
+}
+
+func (s *sqlPreparedStatement) QueryRow(
+	ctx context.Context,
+	args ...any,
+) ds.Row {
+	if err := ctx.Err(); err != nil {
+		return &sqlRow{err: err}
+	}
+	return &sqlRow{row: s.stmt.QueryRowContext(ctx, args...), classify: s.classify}
+}
+
+func (s *sqlPreparedStatement) Name() string {
+	return s.name
+}
+
+//
+// ---------- Results ----------
+//
+
+type execResult struct {
+	res sql.Result
+}
+
+func (r execResult) RowsAffected() int64 {
+	n, err := r.res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+type sqlRows struct {
+	rows     *sql.Rows
+	classify classifier
+}
+
+func (r *sqlRows) Close() error {
+	return r.classify.wrap(r.rows.Close())
+}
+
+func (r *sqlRows) Err() error {
+	return r.classify.wrap(r.rows.Err())
+}
+
+func (r *sqlRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r *sqlRows) Columns() ([]string, error) {
+	columns, err := r.rows.Columns()
+	return columns, r.classify.wrap(err)
+}
+
+func (r *sqlRows) Scan(dest ...any) error {
+	err := r.rows.Scan(dest...)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ds.ErrNoRows
+	}
+	return r.classify.wrap(err)
+}
+
+type sqlRow struct {
+	row      *sql.Row
+	err      error
+	classify classifier
+}
+
+func (r *sqlRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	err := r.row.Scan(dest...)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ds.ErrNoRows
+	}
+	return r.classify.wrap(err)
+}
+
+//
+// ---------- Tx ----------
+//
+
+type sqlTx struct {
+	tx       *sql.Tx
+	classify classifier
+	insert   ds.InsertOptions
+
+	mu         sync.Mutex
+	savepoints int
+}
+
+var (
+	_ ds.Tx            = (*sqlTx)(nil)
+	_ ds.InsertDialect = (*sqlTx)(nil)
+)
+
+func (t *sqlTx) Exec(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (ds.ExecResult, error) {
+	res, err := t.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, t.classify.wrap(err)
+	}
+	return execResult{res: res}, nil
+}
+
+func (t *sqlTx) Query(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (ds.Rows, error) {
+	rows, err := t.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, t.classify.wrap(err)
+	}
+
+	return &sqlRows{
+		rows:     rows,
+		classify: t.classify,
+	}, nil
+}
+
+func (t *sqlTx) QueryRow(
+	ctx context.Context,
+	query string,
+	args ...any,
+) ds.Row {
+	return &sqlRow{
+		row:      t.tx.QueryRowContext(ctx, query, args...),
+		classify: t.classify,
+	}
+}
+
+// InsertOptions configures the ds.CopyFrom fallback, see Options.Insert.
+func (t *sqlTx) InsertOptions() ds.InsertOptions {
+	return t.insert
+}
+
+func (t *sqlTx) SendBatch(ctx context.Context, b *ds.Batch) ds.BatchResults {
+	return ds.SendBatchSequential(ctx, t, b)
+}
+
+// Begin starts a nested transaction backed by a savepoint.
+func (t *sqlTx) Begin(ctx context.Context) (ds.Tx, error) {
+	t.mu.Lock()
+	t.savepoints++
+	name := fmt.Sprintf("ds_sp_%d", t.savepoints)
+	t.mu.Unlock()
+
+	return ds.BeginSavepoint(ctx, t, name)
+}
+
+func (t *sqlTx) Commit(context.Context) error {
+	return t.classify.wrap(t.tx.Commit())
+}
+
+func (t *sqlTx) Rollback(context.Context) error {
+	return t.classify.wrap(t.tx.Rollback())
+}
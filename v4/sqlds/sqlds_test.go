@@ -0,0 +1,329 @@
+package sqlds
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+func newTestProvider(t *testing.T, secondaries map[ds.ServerID]string) *Provider {
+	t.Helper()
+
+	dir := t.TempDir()
+	for id, name := range secondaries {
+		if name == "" {
+			secondaries[id] = filepath.Join(dir, string(id)+".db")
+		}
+	}
+
+	p, err := Open(&Config{
+		DriverName:  "sqlite3",
+		PrimaryDSN:  filepath.Join(dir, "primary.db"),
+		Secondaries: secondaries,
+	})
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+
+	return p
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Fatal("expected error for nil config")
+	}
+	if _, err := New(&Config{PrimaryDSN: "x"}); err == nil {
+		t.Fatal("expected error for empty DriverName")
+	}
+	if _, err := New(&Config{DriverName: "sqlite3"}); err == nil {
+		t.Fatal("expected error for empty PrimaryDSN")
+	}
+}
+
+func TestRegisteredProvider(t *testing.T) {
+	p, err := ds.NewProvider(ProviderID, &Config{
+		DriverName: "sqlite3",
+		PrimaryDSN: filepath.Join(t.TempDir(), "primary.db"),
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	defer p.Close()
+
+	pc, id, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Release(pc, id)
+
+	var n int
+	if err := pc.Conn().QueryRow(context.Background(), "SELECT 1").Scan(&n); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+}
+
+func TestGetSecondaryRoundRobin(t *testing.T) {
+	p := newTestProvider(t, map[ds.ServerID]string{
+		"replica1": "",
+		"replica2": "",
+	})
+
+	seen := map[ds.ServerID]int{}
+	for i := 0; i < 4; i++ {
+		pc, id, err := p.GetSecondary(context.Background(), "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pc.Release()
+		seen[id]++
+	}
+
+	if seen["replica1"] != 2 || seen["replica2"] != 2 {
+		t.Fatalf("expected even distribution, got %v", seen)
+	}
+}
+
+func TestGetSecondarySkipsUnreachableReplica(t *testing.T) {
+	p := newTestProvider(t, map[ds.ServerID]string{
+		"replica1": filepath.Join(t.TempDir(), "missing", "replica1.db"),
+		"replica2": "",
+	})
+
+	for i := 0; i < 2; i++ {
+		pc, id, err := p.GetSecondary(context.Background(), "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pc.Release()
+
+		if id != "replica2" {
+			t.Fatalf("expected replica2, got %s", id)
+		}
+	}
+}
+
+func TestGetSecondaryWithLSNUsesPrimary(t *testing.T) {
+	p := newTestProvider(t, map[ds.ServerID]string{
+		"replica1": "",
+	})
+
+	pc, id, err := p.GetSecondary(context.Background(), "0/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	if id != PrimaryID {
+		t.Fatalf("expected primary, got %s", id)
+	}
+}
+
+func TestGetSecondaryWithoutReplicas(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	pc, id, err := p.GetSecondary(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	if id != PrimaryID {
+		t.Fatalf("expected primary, got %s", id)
+	}
+}
+
+func TestGetSecondaryCancelledContext(t *testing.T) {
+	p := newTestProvider(t, map[ds.ServerID]string{
+		"replica1": "",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := p.GetSecondary(ctx, ""); err == nil {
+		t.Fatal("expected error for cancelled context")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dstest.RunConformance(t, func(t *testing.T) ds.Provider {
+		return newTestProvider(t, nil)
+	})
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t, nil)
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	tx, err := pc.Conn().BeginTx(ctx, ds.TxOptions{
+		Isolation:  ds.IsolationSerializable,
+		AccessMode: ds.AccessReadOnly,
+	})
+	if err != nil {
+		t.Fatalf("BeginTx() failed: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	if _, err := pc.Conn().BeginTx(ctx, ds.TxOptions{Deferrable: true}); err == nil {
+		t.Fatal("expected error for deferrable transaction")
+	}
+}
+
+func TestStats(t *testing.T) {
+	p := newTestProvider(t, map[ds.ServerID]string{
+		"replica1": "",
+		"replica2": filepath.Join(t.TempDir(), "missing", "replica2.db"),
+	})
+
+	for i := 0; i < 2; i++ {
+		pc, _, err := p.GetSecondary(context.Background(), "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer pc.Release()
+	}
+
+	st := p.Stats()
+	if len(st.Servers) != 3 {
+		t.Fatalf("expected 3 servers, got %+v", st.Servers)
+	}
+	if st.Servers[1].ID != "replica1" || st.Servers[1].SecondaryServed != 2 {
+		t.Fatalf("unexpected replica1 stats: %+v", st.Servers[1])
+	}
+	if st.Servers[1].AcquiredConns != 2 {
+		t.Fatalf("expected 2 leased connections, got %d", st.Servers[1].AcquiredConns)
+	}
+	if st.PrimaryFallbacks != 0 {
+		t.Fatalf("expected no fallbacks, got %d", st.PrimaryFallbacks)
+	}
+}
+
+func TestCopyFromUsesInsertOptions(t *testing.T) {
+	p, err := Open(&Config{
+		DriverName: "sqlite3",
+		PrimaryDSN: filepath.Join(t.TempDir(), "primary.db"),
+		Options: Options{
+			Insert: ds.InsertOptions{Placeholder: ds.QuestionPlaceholder, MaxParams: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	pc, id, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Release(pc, id)
+	conn := pc.Conn()
+
+	if opts := conn.(ds.InsertDialect).InsertOptions(); opts.MaxParams != 4 {
+		t.Fatalf("unexpected insert options: %+v", opts)
+	}
+	if _, err := conn.Exec(ctx, "CREATE TABLE users (id INTEGER, name TEXT)"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := ds.CopyFrom(ctx, tx, "users", []string{"id", "name"}, ds.CopyFromRows([][]any{
+		{1, "alice"},
+		{2, "bob"},
+		{3, "carol"},
+	}))
+	if err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	var count int
+	if err := conn.QueryRow(ctx, "SELECT count(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 rows, got %d", count)
+	}
+}
+
+// dialectConn applies InsertOptions to a dstest connection.
+type dialectConn struct {
+	ds.Conn
+	opts ds.InsertOptions
+}
+
+func (c dialectConn) InsertOptions() ds.InsertOptions { return c.opts }
+
+func TestDriverInsertOptions(t *testing.T) {
+	tests := []struct {
+		driver string
+		sql    string
+	}{
+		{"sqlite3", `^INSERT INTO "app"\."users" \("id", "name"\) VALUES \(\$1, \$2\)$`},
+		{"mysql", "^INSERT INTO `app`\\.`users` \\(`id`, `name`\\) VALUES \\(\\?, \\?\\)$"},
+		{"sqlserver", `^INSERT INTO \[app\]\.\[users\] \(\[id\], \[name\]\) VALUES \(@p1, @p2\)$`},
+		{"mssql", `^INSERT INTO \[app\]\.\[users\] \(\[id\], \[name\]\) VALUES \(@p1, @p2\)$`},
+	}
+	tested := make(map[string]bool, len(tests))
+	for _, tt := range tests {
+		tested[tt.driver] = true
+		t.Run(tt.driver, func(t *testing.T) {
+			p := dstest.New(t)
+			p.ExpectGetPrimary()
+			p.ExpectExec(tt.sql).WithArgs(1, "alice").WillReturnResult(1)
+
+			pc, _, err := p.GetPrimary(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer pc.Release()
+
+			conn := dialectConn{Conn: pc.Conn(), opts: insertOptions(tt.driver, ds.InsertOptions{})}
+			if _, err := ds.CopyFrom(context.Background(), conn, "app.users", []string{"id", "name"}, ds.CopyFromRows([][]any{{1, "alice"}})); err != nil {
+				t.Fatalf("CopyFrom failed: %v", err)
+			}
+		})
+	}
+
+	for driver := range driverInsertOptions {
+		if !tested[driver] {
+			t.Errorf("no test for driver %s", driver)
+		}
+	}
+
+	// Explicit styles are kept.
+	opts := insertOptions("mysql", ds.InsertOptions{QuoteIdentifier: ds.DoubleQuoteIdentifier})
+	if got := opts.QuoteIdentifier("users"); got != `"users"` {
+		t.Fatalf("expected the configured quoting, got %s", got)
+	}
+	if got := opts.Placeholder(1); got != "?" {
+		t.Fatalf("expected the driver placeholder, got %s", got)
+	}
+}
@@ -0,0 +1,43 @@
+package sqlds
+
+import (
+	"database/sql"
+
+	"github.com/dronm/ds/v4"
+)
+
+var _ ds.StatsProvider = (*Provider)(nil)
+
+// Stats returns database/sql pool statistics of every server together
+// with routing counters. database/sql does not count acquisitions, so
+// only waits for a free connection are reported.
+func (p *Provider) Stats() ds.Stats {
+	st := ds.Stats{
+		PrimaryFallbacks: p.primaryFallbacks.Load(),
+	}
+
+	st.Servers = append(st.Servers, serverStats(PrimaryID, p.primary, true))
+
+	for _, id := range p.secondaryIDs {
+		s := serverStats(id, p.secondaries[id], false)
+		s.SecondaryServed = p.secondaryServed[id].Load()
+		st.Servers = append(st.Servers, s)
+	}
+
+	return st
+}
+
+func serverStats(id ds.ServerID, db *sql.DB, primary bool) ds.ServerStats {
+	dbs := db.Stats()
+
+	return ds.ServerStats{
+		ID:                  id,
+		Primary:             primary,
+		AcquiredConns:       int32(dbs.InUse),
+		IdleConns:           int32(dbs.Idle),
+		TotalConns:          int32(dbs.OpenConnections),
+		MaxConns:            int32(dbs.MaxOpenConnections),
+		AcquireWaitCount:    dbs.WaitCount,
+		AcquireWaitDuration: dbs.WaitDuration,
+	}
+}
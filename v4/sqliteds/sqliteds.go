@@ -0,0 +1,153 @@
+// Package sqliteds implements a SQLite data storage provider
+// based on database/sql and github.com/mattn/go-sqlite3.
+// SQLite has no replicas, so secondary requests are served by the primary.
+package sqliteds
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/sqlds"
+)
+
+const (
+	ProviderID = "sqlite"
+	PrimaryID  = sqlds.PrimaryID
+
+	// DefaultDriverName is the database/sql driver used when
+	// Config.DriverName is empty.
+	DefaultDriverName = "sqlite3"
+)
+
+//
+// ---------- Config ----------
+//
+
+type Config struct {
+	// Path is a database file name or a SQLite DSN
+	// such as "file:test.db?cache=shared".
+	Path string
+	// DriverName is the registered database/sql driver name.
+	DriverName string
+	// MaxOpenConns limits open connections, zero means no limit.
+	MaxOpenConns int
+	// Hooks observe every operation on leased connections.
+	Hooks []ds.Hook
+	// Logger receives records about acquisitions and, through
+	// ds.NewLogHook, about queries. Nil disables logging.
+	Logger *slog.Logger
+	// LogOptions configures query records written to Logger.
+	LogOptions ds.LogOptions
+}
+
+//
+// ---------- Provider registration ----------
+//
+
+func init() {
+	ds.Register(ProviderID, New)
+}
+
+// New returns a *sqlds.Provider serving the SQLite database at c.Path.
+func New(cfg any) (ds.Provider, error) {
+	c, ok := cfg.(*Config)
+	if !ok {
+		return nil, errors.New("sqliteds: config must be *sqliteds.Config")
+	}
+	if c.Path == "" {
+		return nil, errors.New("sqliteds: Path is required")
+	}
+
+	driverName := c.DriverName
+	if driverName == "" {
+		driverName = DefaultDriverName
+	}
+
+	db, err := sql.Open(driverName, c.Path)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+
+	return sqlds.NewWithDB(db, nil, sqlds.Options{
+		Hooks:         c.Hooks,
+		Logger:        c.Logger,
+		LogOptions:    c.LogOptions,
+		IsRetryable:   IsRetryable,
+		ClassifyError: ClassifyError,
+		// SQLITE_MAX_VARIABLE_NUMBER of the bundled SQLite.
+		Insert: ds.InsertOptions{MaxParams: 32766},
+	}), nil
+}
+
+// IsRetryable reports whether err means the database was busy or locked
+// by another connection, so the transaction may be run again.
+func IsRetryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// ClassifyError wraps SQLite errors of a known class in a *ds.Error.
+// Table and column, or the constraint for CHECK violations, are taken
+// from the error message. Other errors are returned as is.
+func ClassifyError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	e := &ds.Error{
+		DriverCode: strconv.Itoa(int(sqliteErr.ExtendedCode)),
+		Err:        err,
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		e.Code = ds.CodeUniqueViolation
+	case sqlite3.ErrConstraintForeignKey:
+		e.Code = ds.CodeForeignKeyViolation
+	case sqlite3.ErrConstraintNotNull:
+		e.Code = ds.CodeNotNullViolation
+	case sqlite3.ErrConstraintCheck:
+		e.Code = ds.CodeCheckViolation
+	case sqlite3.ErrBusySnapshot:
+		e.Code = ds.CodeSerializationFailure
+	default:
+		switch sqliteErr.Code {
+		case sqlite3.ErrReadonly:
+			e.Code = ds.CodeReadOnlyTransaction
+		case sqlite3.ErrInterrupt:
+			e.Code = ds.CodeQueryCanceled
+		default:
+			return err
+		}
+	}
+
+	// Messages look like "UNIQUE constraint failed: users.email"
+	// or "CHECK constraint failed: positive_balance".
+	_, target, ok := strings.Cut(sqliteErr.Error(), "constraint failed: ")
+	if !ok {
+		return e
+	}
+	if e.Code == ds.CodeCheckViolation {
+		e.Constraint = target
+		return e
+	}
+
+	target, _, _ = strings.Cut(target, ", ")
+	e.Table, e.Column, _ = strings.Cut(target, ".")
+
+	return e
+}
@@ -0,0 +1,307 @@
+package sqliteds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
+)
+
+func newTestProvider(t *testing.T) ds.Provider {
+	t.Helper()
+
+	p, err := ds.NewProvider(ProviderID, &Config{
+		Path: filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+
+	pc, _, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer pc.Release()
+
+	if _, err := pc.Conn().Exec(context.Background(),
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+	); err != nil {
+		t.Fatalf("create table failed: %v", err)
+	}
+
+	return p
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Fatal("expected error for nil config")
+	}
+	if _, err := New(&Config{}); err == nil {
+		t.Fatal("expected error for empty Path")
+	}
+}
+
+func TestExecAndQuery(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	pc, id, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Release(pc, id)
+
+	if id != PrimaryID {
+		t.Fatalf("expected primary, got %s", id)
+	}
+
+	res, err := pc.Conn().Exec(ctx, `INSERT INTO users(name) VALUES (?), (?)`, "alice", "bob")
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if res.RowsAffected() != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", res.RowsAffected())
+	}
+
+	rows, err := pc.Conn().Query(ctx, `SELECT name FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows failed: %v", err)
+	}
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+}
+
+func TestQueryRowNoRows(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	pc, _, err := p.GetSecondary(ctx, "0/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	var name string
+	err = pc.Conn().QueryRow(ctx, `SELECT name FROM users WHERE id = ?`, 42).Scan(&name)
+	if !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("expected ds.ErrNoRows, got %v", err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	expectedErr := errors.New("callback failed")
+	err = ds.WithTx(ctx, pc.Conn(), func(ctx context.Context, tx ds.Tx) error {
+		if _, err := tx.Exec(ctx, `INSERT INTO users(name) VALUES (?)`, "alice"); err != nil {
+			return err
+		}
+		return expectedErr
+	})
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+
+	err = ds.WithTx(ctx, pc.Conn(), func(ctx context.Context, tx ds.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO users(name) VALUES (?)`, "bob")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var count int
+	if err := pc.Conn().QueryRow(ctx, `SELECT count(*) FROM users`).Scan(&count); err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 committed row, got %d", count)
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pc.Release()
+
+	ins, err := pc.Conn().Prepare(ctx, "insert_user", `INSERT INTO users(name) VALUES (?)`)
+	if err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+	if ins.Name() != "insert_user" {
+		t.Fatalf("unexpected statement name %q", ins.Name())
+	}
+	if _, err := ins.Exec(ctx, "alice"); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+
+	sel, err := pc.Conn().Prepare(ctx, "select_user", `SELECT name FROM users WHERE id = ?`)
+	if err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+
+	var name string
+	if err := sel.QueryRow(ctx, 1).Scan(&name); err != nil {
+		t.Fatalf("query row failed: %v", err)
+	}
+	if name != "alice" {
+		t.Fatalf("expected alice, got %q", name)
+	}
+	if err := sel.QueryRow(ctx, 2).Scan(&name); !errors.Is(err, ds.ErrNoRows) {
+		t.Fatalf("expected ds.ErrNoRows, got %v", err)
+	}
+}
+
+func TestReleaseIsIdempotent(t *testing.T) {
+	p := newTestProvider(t)
+
+	pc, id, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pc.Release()
+	p.Release(pc, id)
+}
+
+func TestConformance(t *testing.T) {
+	dstest.RunConformance(t, func(t *testing.T) ds.Provider {
+		p, err := New(&Config{
+			Path: filepath.Join(t.TempDir(), "conformance.db"),
+		})
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		return p
+	})
+}
+
+func TestWithTxRetryBusy(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer pc.Release()
+
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	calls := 0
+	err = ds.WithTxRetry(ctx, pc.Conn(), ds.TxOptions{}, ds.RetryPolicy{}, func(ctx context.Context, tx ds.Tx) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("insert: %w", busy)
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO users(name) VALUES(?)", "alice")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+
+	if IsRetryable(errors.New("constraint failed")) {
+		t.Fatal("expected plain errors not to be retryable")
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := ds.NewProvider(ProviderID, &Config{
+		Path: "file:" + filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on",
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+
+	pc, _, err := p.GetPrimary(ctx)
+	if err != nil {
+		t.Fatalf("GetPrimary() failed: %v", err)
+	}
+	defer pc.Release()
+	conn := pc.Conn()
+
+	for _, sql := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE accounts (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			balance INTEGER NOT NULL CONSTRAINT positive_balance CHECK (balance >= 0)
+		)`,
+		`INSERT INTO users(id, email) VALUES(1, 'alice@example.com')`,
+	} {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		sql        string
+		want       error
+		table      string
+		column     string
+		constraint string
+	}{
+		{`INSERT INTO users(id, email) VALUES(2, 'alice@example.com')`, ds.ErrUniqueViolation, "users", "email", ""},
+		{`INSERT INTO users(id, email) VALUES(1, 'bob@example.com')`, ds.ErrUniqueViolation, "users", "id", ""},
+		{`INSERT INTO users(id, email) VALUES(3, NULL)`, ds.ErrNotNullViolation, "users", "email", ""},
+		{`INSERT INTO accounts(user_id, balance) VALUES(1, -1)`, ds.ErrCheckViolation, "", "", "positive_balance"},
+		{`INSERT INTO accounts(user_id, balance) VALUES(42, 0)`, ds.ErrForeignKeyViolation, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		_, err := conn.Exec(ctx, tt.sql)
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.sql, tt.want, err)
+		}
+
+		details, ok := ds.ErrorDetails(err)
+		if !ok {
+			t.Fatalf("%s: expected details", tt.sql)
+		}
+		if details.Table != tt.table || details.Column != tt.column || details.Constraint != tt.constraint {
+			t.Fatalf("%s: unexpected details %+v", tt.sql, details)
+		}
+	}
+
+	if _, ok := ds.ErrorDetails(ClassifyError(errors.New("boom"))); ok {
+		t.Fatal("expected plain errors to be left unclassified")
+	}
+}
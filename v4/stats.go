@@ -0,0 +1,143 @@
+package ds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServerStats is a snapshot of the pool and routing counters of one server.
+// Pool fields are zero until the provider has opened the server's pool.
+type ServerStats struct {
+	ID      ServerID
+	Primary bool
+
+	AcquiredConns int32
+	IdleConns     int32
+	TotalConns    int32
+	MaxConns      int32
+
+	// AcquireCount is the number of successful acquisitions and
+	// AcquireDuration their total duration.
+	AcquireCount    int64
+	AcquireDuration time.Duration
+	// AcquireWaitCount is the number of acquisitions that had to wait
+	// for a connection and AcquireWaitDuration the total time waited.
+	AcquireWaitCount    int64
+	AcquireWaitDuration time.Duration
+	// CanceledAcquireCount is the number of acquisitions canceled
+	// by their context.
+	CanceledAcquireCount int64
+
+	// SecondaryServed is the number of GetSecondary calls served
+	// by this server as a replica.
+	SecondaryServed int64
+	// ReplicaCheckErrors is the number of failed replica checks.
+	ReplicaCheckErrors int64
+}
+
+// Stats is a snapshot of provider metrics.
+type Stats struct {
+	// Servers lists the primary first, then secondaries ordered by ID.
+	Servers []ServerStats
+	// PrimaryFallbacks is the number of GetSecondary calls served
+	// by the primary although secondaries are configured.
+	PrimaryFallbacks int64
+	// LSNWaitTimeouts is the number of GetSecondary calls where no
+	// replica reached the requested LSN in time.
+	LSNWaitTimeouts int64
+}
+
+// StatsProvider is implemented by providers that expose metrics.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+// WritePrometheus writes s to w in the Prometheus text exposition format.
+// Metric names are prefixed with namespace, "ds" if empty.
+func WritePrometheus(w io.Writer, namespace string, s Stats) error {
+	if namespace == "" {
+		namespace = "ds"
+	}
+
+	bw := bufio.NewWriter(w)
+
+	type metric struct {
+		name  string
+		kind  string
+		help  string
+		value func(ServerStats) float64
+	}
+
+	serverMetrics := []metric{
+		{"pool_acquired_conns", "gauge", "Connections currently leased.",
+			func(s ServerStats) float64 { return float64(s.AcquiredConns) }},
+		{"pool_idle_conns", "gauge", "Idle connections in the pool.",
+			func(s ServerStats) float64 { return float64(s.IdleConns) }},
+		{"pool_total_conns", "gauge", "Total connections in the pool.",
+			func(s ServerStats) float64 { return float64(s.TotalConns) }},
+		{"pool_max_conns", "gauge", "Maximum pool size.",
+			func(s ServerStats) float64 { return float64(s.MaxConns) }},
+		{"pool_acquire_total", "counter", "Successful connection acquisitions.",
+			func(s ServerStats) float64 { return float64(s.AcquireCount) }},
+		{"pool_acquire_duration_seconds_total", "counter", "Total time spent acquiring connections.",
+			func(s ServerStats) float64 { return s.AcquireDuration.Seconds() }},
+		{"pool_acquire_wait_total", "counter", "Acquisitions that waited for a free connection.",
+			func(s ServerStats) float64 { return float64(s.AcquireWaitCount) }},
+		{"pool_acquire_wait_seconds_total", "counter", "Total time spent waiting for a free connection.",
+			func(s ServerStats) float64 { return s.AcquireWaitDuration.Seconds() }},
+		{"pool_canceled_acquire_total", "counter", "Acquisitions canceled by their context.",
+			func(s ServerStats) float64 { return float64(s.CanceledAcquireCount) }},
+		{"secondary_served_total", "counter", "GetSecondary calls served by the server as a replica.",
+			func(s ServerStats) float64 { return float64(s.SecondaryServed) }},
+		{"replica_check_errors_total", "counter", "Failed replica checks.",
+			func(s ServerStats) float64 { return float64(s.ReplicaCheckErrors) }},
+	}
+
+	for _, m := range serverMetrics {
+		name := namespace + "_" + m.name
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind)
+
+		for _, srv := range s.Servers {
+			role := "secondary"
+			if srv.Primary {
+				role = "primary"
+			}
+			fmt.Fprintf(bw, "%s{server=\"%s\",role=\"%s\"} %v\n",
+				name, escapeLabel(string(srv.ID)), role, m.value(srv))
+		}
+	}
+
+	providerMetrics := []struct {
+		name  string
+		help  string
+		value int64
+	}{
+		{"primary_fallbacks_total", "GetSecondary calls served by the primary although secondaries are configured.", s.PrimaryFallbacks},
+		{"lsn_wait_timeouts_total", "GetSecondary calls where no replica reached the requested LSN in time.", s.LSNWaitTimeouts},
+	}
+
+	for _, m := range providerMetrics {
+		name := namespace + "_" + m.name
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, m.help, name, name, m.value)
+	}
+
+	return bw.Flush()
+}
+
+// PrometheusHandler serves the metrics of p in the Prometheus text format.
+func PrometheusHandler(namespace string, p StatsProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w, namespace, p.Stats())
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
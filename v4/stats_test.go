@@ -0,0 +1,61 @@
+package ds_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dronm/ds/v4"
+)
+
+type staticStats ds.Stats
+
+func (s staticStats) Stats() ds.Stats { return ds.Stats(s) }
+
+func TestWritePrometheus(t *testing.T) {
+	stats := ds.Stats{
+		Servers: []ds.ServerStats{
+			{ID: "primary", Primary: true, AcquiredConns: 2, AcquireDuration: 1500 * time.Millisecond},
+			{ID: `replica"1`, SecondaryServed: 7, ReplicaCheckErrors: 1},
+		},
+		PrimaryFallbacks: 3,
+		LSNWaitTimeouts:  2,
+	}
+
+	var sb strings.Builder
+	if err := ds.WritePrometheus(&sb, "app_db", stats); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := sb.String()
+
+	for _, line := range []string{
+		"# TYPE app_db_pool_acquired_conns gauge",
+		`app_db_pool_acquired_conns{server="primary",role="primary"} 2`,
+		`app_db_pool_acquire_duration_seconds_total{server="primary",role="primary"} 1.5`,
+		`app_db_secondary_served_total{server="replica\"1",role="secondary"} 7`,
+		`app_db_replica_check_errors_total{server="replica\"1",role="secondary"} 1`,
+		"# TYPE app_db_primary_fallbacks_total counter",
+		"app_db_primary_fallbacks_total 3",
+		"app_db_lsn_wait_timeouts_total 2",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	h := ds.PrometheusHandler("", staticStats{PrimaryFallbacks: 1})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "ds_primary_fallbacks_total 1\n") {
+		t.Fatalf("unexpected body:\n%s", rec.Body.String())
+	}
+}
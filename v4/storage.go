@@ -3,10 +3,13 @@ package ds
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var ErrNoRows = errors.New("no rows in result set")
 var ErrTxCommitRollback = errors.New("transaction commit resulted in rollback")
+var ErrTxDone = errors.New("ds: transaction has already been committed or rolled back")
 
 type ServerID string
 
@@ -17,6 +20,8 @@ type Rows interface {
 	Err() error
 	Next() bool
 	Scan(dest ...any) error
+	// Columns returns the result column names in order.
+	Columns() ([]string, error)
 }
 
 type Row interface {
@@ -42,16 +47,100 @@ type PreparedStatement interface {
 	Name() string
 }
 
+// Beginner starts transactions. Conn begins a transaction,
+// Tx begins a nested one backed by a savepoint.
+type Beginner interface {
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Batcher sends queued statements together. Providers that support
+// pipelining send them in one round trip, others run them one by one
+// with SendBatchSequential.
+type Batcher interface {
+	SendBatch(ctx context.Context, b *Batch) BatchResults
+}
+
+// Tx is a transaction. Begin starts a nested transaction whose Commit
+// releases its savepoint and whose Rollback rolls back to it, leaving
+// the enclosing transaction open.
 type Tx interface {
 	Querier
+	Beginner
+	Batcher
 	Commit(ctx context.Context) error
 	Rollback(ctx context.Context) error
 }
 
 type Conn interface {
 	Querier
+	Beginner
+	Batcher
+	// BeginTx starts a transaction with opts. Begin is equivalent
+	// to BeginTx with zero TxOptions.
+	BeginTx(ctx context.Context, opts TxOptions) (Tx, error)
 	Prepare(ctx context.Context, name string, sql string) (PreparedStatement, error)
-	Begin(ctx context.Context) (Tx, error)
+}
+
+// IsolationLevel is the isolation level of a transaction.
+type IsolationLevel int
+
+const (
+	// IsolationDefault uses the default level of the server.
+	IsolationDefault IsolationLevel = iota
+	IsolationReadUncommitted
+	IsolationReadCommitted
+	IsolationRepeatableRead
+	IsolationSerializable
+)
+
+func (l IsolationLevel) String() string {
+	switch l {
+	case IsolationDefault:
+		return "default"
+	case IsolationReadUncommitted:
+		return "read uncommitted"
+	case IsolationReadCommitted:
+		return "read committed"
+	case IsolationRepeatableRead:
+		return "repeatable read"
+	case IsolationSerializable:
+		return "serializable"
+	}
+	return "unknown"
+}
+
+// AccessMode tells whether a transaction may write.
+type AccessMode int
+
+const (
+	// AccessDefault uses the default access mode of the server.
+	AccessDefault AccessMode = iota
+	AccessReadWrite
+	AccessReadOnly
+)
+
+func (m AccessMode) String() string {
+	switch m {
+	case AccessDefault:
+		return "default"
+	case AccessReadWrite:
+		return "read write"
+	case AccessReadOnly:
+		return "read only"
+	}
+	return "unknown"
+}
+
+// TxOptions configures a transaction started with BeginTx.
+// The zero value starts a transaction with the server defaults.
+type TxOptions struct {
+	Isolation  IsolationLevel
+	AccessMode AccessMode
+	// Deferrable lets a serializable read-only transaction wait for a
+	// snapshot free of serialization anomalies instead of risking
+	// a serialization failure. Providers that cannot express it
+	// return an error from BeginTx.
+	Deferrable bool
 }
 
 // WithTx starts a transaction, executes fn, and commits when fn returns nil.
@@ -59,12 +148,49 @@ type Conn interface {
 // If fn returns an error, the transaction is rolled back and the original error
 // is returned. If fn panics, the transaction is rolled back and the panic is
 // re-thrown.
+//
+// conn may be a Conn or a Tx. Inside a Tx, fn runs in a nested transaction,
+// so functions using WithTx compose regardless of whether the caller already
+// opened a transaction.
+//
+// If ctx carries a ConsistencyToken and conn is a Conn, the LSN of conn after
+// commit is recorded in it. Failing to read the LSN does not fail the
+// committed transaction; hooks of conn see it as a failed OpCurrentLSN.
 func WithTx(
+	ctx context.Context,
+	conn Beginner,
+	fn func(ctx context.Context, tx Tx) error,
+) error {
+	return runTx(ctx, conn, conn.Begin, true, fn)
+}
+
+// WithTxOptions is like WithTx but starts the transaction with opts.
+// Read-only transactions leave the ConsistencyToken unchanged:
+//
+//	err := ds.WithTxOptions(ctx, conn, ds.TxOptions{
+//		Isolation: ds.IsolationSerializable,
+//	}, transfer)
+func WithTxOptions(
 	ctx context.Context,
 	conn Conn,
+	opts TxOptions,
+	fn func(ctx context.Context, tx Tx) error,
+) error {
+	return runTx(ctx, conn, func(ctx context.Context) (Tx, error) {
+		return conn.BeginTx(ctx, opts)
+	}, opts.AccessMode != AccessReadOnly, fn)
+}
+
+// runTx runs fn in a transaction started with begin. capture records
+// the LSN after commit for transactions that may have written.
+func runTx(
+	ctx context.Context,
+	conn Beginner,
+	begin func(ctx context.Context) (Tx, error),
+	capture bool,
 	fn func(ctx context.Context, tx Tx) error,
 ) (err error) {
-	tx, err := conn.Begin(ctx)
+	tx, err := begin(ctx)
 	if err != nil {
 		return err
 	}
@@ -88,6 +214,11 @@ func WithTx(
 		return err
 	}
 
+	if c, ok := conn.(Conn); ok && capture {
+		// Hooks report failures; the transaction is committed anyway.
+		_ = CaptureLSN(ctx, c)
+	}
+
 	return nil
 }
 
@@ -104,3 +235,114 @@ type Storage interface {
 	GetSecondary(ctx context.Context, minLSN string) (PoolConn, ServerID, error)
 	Release(PoolConn, ServerID)
 }
+
+// ---------- Read consistency ----------
+
+var ErrInvalidReadOptions = errors.New("ds: invalid read options")
+
+// ErrReplicaNotCaughtUp is returned by providers configured not to fall
+// back to the primary when no replica reached the requested LSN in time.
+var ErrReplicaNotCaughtUp = errors.New("ds: no replica caught up to the requested LSN")
+
+// Consistency is the freshness a read requires.
+type Consistency int
+
+const (
+	// Eventual reads from any secondary regardless of its lag.
+	Eventual Consistency = iota
+	// ReadYourWrites reads from a secondary that has replayed MinLSN.
+	ReadYourWrites
+	// BoundedStaleness reads from a secondary lagging at most
+	// MaxLagBytes behind the primary and MaxLag behind in time.
+	BoundedStaleness
+	// Strong reads from the primary.
+	Strong
+)
+
+func (c Consistency) String() string {
+	switch c {
+	case Eventual:
+		return "eventual"
+	case ReadYourWrites:
+		return "read_your_writes"
+	case BoundedStaleness:
+		return "bounded_staleness"
+	case Strong:
+		return "strong"
+	}
+	return "unknown"
+}
+
+// ReadOptions describes the consistency a read requires.
+// Secondaries that do not qualify are skipped and the read falls back
+// to the primary, which satisfies every level.
+type ReadOptions struct {
+	Consistency Consistency
+
+	// MinLSN is the position a ReadYourWrites read must observe.
+	// If zero, the ConsistencyToken of the context is used.
+	MinLSN LSN
+
+	// MaxLagBytes bounds the WAL distance between the primary and a
+	// secondary for BoundedStaleness. Zero disables the bound.
+	MaxLagBytes int64
+	// MaxLag bounds the age of the last transaction replayed by a
+	// secondary for BoundedStaleness. A secondary that has replayed all
+	// WAL it received is not lagging. Zero disables the bound.
+	MaxLag time.Duration
+}
+
+// Validate reports options that cannot be satisfied.
+func (o ReadOptions) Validate() error {
+	switch o.Consistency {
+	case Eventual, ReadYourWrites, Strong:
+		return nil
+	case BoundedStaleness:
+		if o.MaxLagBytes < 0 || o.MaxLag < 0 {
+			return fmt.Errorf("%w: negative lag bound", ErrInvalidReadOptions)
+		}
+		if o.MaxLagBytes == 0 && o.MaxLag == 0 {
+			return fmt.Errorf("%w: bounded staleness requires MaxLagBytes or MaxLag", ErrInvalidReadOptions)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown consistency %d", ErrInvalidReadOptions, int(o.Consistency))
+}
+
+// ConsistentReader is implemented by storages that route reads
+// by ReadOptions.
+type ConsistentReader interface {
+	GetSecondaryWith(ctx context.Context, opts ReadOptions) (PoolConn, ServerID, error)
+}
+
+// GetSecondaryFrom acquires a connection from s that satisfies opts.
+//
+// Storages that do not implement ConsistentReader serve Strong and
+// BoundedStaleness reads from the primary and the other levels through
+// GetSecondary.
+func GetSecondaryFrom(ctx context.Context, s Storage, opts ReadOptions) (PoolConn, ServerID, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	if opts.Consistency == ReadYourWrites && opts.MinLSN == 0 {
+		if t, ok := ConsistencyTokenFromContext(ctx); ok {
+			opts.MinLSN, _ = t.Position()
+		}
+	}
+
+	if r, ok := s.(ConsistentReader); ok {
+		return r.GetSecondaryWith(ctx, opts)
+	}
+
+	switch opts.Consistency {
+	case ReadYourWrites:
+		if opts.MinLSN != 0 {
+			return s.GetSecondary(ctx, opts.MinLSN.String())
+		}
+		return s.GetSecondary(ctx, "")
+	case Eventual:
+		return s.GetSecondary(ctx, "")
+	}
+	return s.GetPrimary(ctx)
+}
@@ -4,111 +4,32 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/dronm/ds/v4"
+	"github.com/dronm/ds/v4/dstest"
 )
 
-type withTxExecResult struct{}
+func primaryConn(t *testing.T, p *dstest.Provider) ds.Conn {
+	t.Helper()
 
-func (r withTxExecResult) RowsAffected() int64 { return 0 }
-
-type withTxRows struct{}
-
-func (r withTxRows) Close() error           { return nil }
-func (r withTxRows) Err() error             { return nil }
-func (r withTxRows) Next() bool             { return false }
-func (r withTxRows) Scan(dest ...any) error { return nil }
-
-type withTxRow struct{}
-
-func (r withTxRow) Scan(dest ...any) error { return nil }
-
-type withTxPreparedStatement struct {
-	name string
-}
-
-func (s withTxPreparedStatement) Exec(context.Context, ...any) (ds.ExecResult, error) {
-	return withTxExecResult{}, nil
-}
-
-func (s withTxPreparedStatement) Query(context.Context, ...any) (ds.Rows, error) {
-	return withTxRows{}, nil
-}
-
-func (s withTxPreparedStatement) QueryRow(context.Context, ...any) ds.Row {
-	return withTxRow{}
-}
-
-func (s withTxPreparedStatement) Name() string {
-	return s.name
-}
-
-type withTxConn struct {
-	tx       *withTxTx
-	beginErr error
-}
-
-func (c *withTxConn) Exec(context.Context, string, ...any) (ds.ExecResult, error) {
-	return withTxExecResult{}, nil
-}
-
-func (c *withTxConn) Query(context.Context, string, ...any) (ds.Rows, error) {
-	return withTxRows{}, nil
-}
-
-func (c *withTxConn) QueryRow(context.Context, string, ...any) ds.Row {
-	return withTxRow{}
-}
-
-func (c *withTxConn) Prepare(
-	context.Context,
-	string,
-	string,
-) (ds.PreparedStatement, error) {
-	return withTxPreparedStatement{name: "stmt"}, nil
-}
-
-func (c *withTxConn) Begin(context.Context) (ds.Tx, error) {
-	if c.beginErr != nil {
-		return nil, c.beginErr
+	pc, _, err := p.GetPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
+	t.Cleanup(pc.Release)
 
-	return c.tx, nil
-}
-
-type withTxTx struct {
-	commitErr  error
-	committed  bool
-	rolledBack bool
-}
-
-func (t *withTxTx) Exec(context.Context, string, ...any) (ds.ExecResult, error) {
-	return withTxExecResult{}, nil
-}
-
-func (t *withTxTx) Query(context.Context, string, ...any) (ds.Rows, error) {
-	return withTxRows{}, nil
-}
-
-func (t *withTxTx) QueryRow(context.Context, string, ...any) ds.Row {
-	return withTxRow{}
-}
-
-func (t *withTxTx) Commit(context.Context) error {
-	t.committed = true
-
-	return t.commitErr
-}
-
-func (t *withTxTx) Rollback(context.Context) error {
-	t.rolledBack = true
-
-	return nil
+	return pc.Conn()
 }
 
 func TestWithTxCommitsOnSuccess(t *testing.T) {
-	tx := &withTxTx{}
-	conn := &withTxConn{tx: tx}
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectExec(`SELECT 1`)
+	p.ExpectCommit()
+
+	conn := primaryConn(t, p)
 
 	err := ds.WithTx(context.Background(), conn, func(ctx context.Context, tx ds.Tx) error {
 		_, err := tx.Exec(ctx, "SELECT 1")
@@ -118,17 +39,15 @@ func TestWithTxCommitsOnSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !tx.committed {
-		t.Fatal("expected commit")
-	}
-	if tx.rolledBack {
-		t.Fatal("did not expect rollback")
-	}
 }
 
 func TestWithTxRollsBackOnCallbackError(t *testing.T) {
-	tx := &withTxTx{}
-	conn := &withTxConn{tx: tx}
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectRollback()
+
+	conn := primaryConn(t, p)
 	expectedErr := errors.New("callback failed")
 
 	err := ds.WithTx(context.Background(), conn, func(context.Context, ds.Tx) error {
@@ -137,18 +56,18 @@ func TestWithTxRollsBackOnCallbackError(t *testing.T) {
 	if !errors.Is(err, expectedErr) {
 		t.Fatalf("expected callback error, got %v", err)
 	}
-	if tx.committed {
-		t.Fatal("did not expect commit")
-	}
-	if !tx.rolledBack {
-		t.Fatal("expected rollback")
-	}
 }
 
 func TestWithTxReturnsCommitError(t *testing.T) {
 	expectedErr := errors.New("commit failed")
-	tx := &withTxTx{commitErr: expectedErr}
-	conn := &withTxConn{tx: tx}
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin()
+	p.ExpectCommit().WillReturnError(expectedErr)
+	p.ExpectRollback()
+
+	conn := primaryConn(t, p)
 
 	err := ds.WithTx(context.Background(), conn, func(context.Context, ds.Tx) error {
 		return nil
@@ -156,10 +75,112 @@ func TestWithTxReturnsCommitError(t *testing.T) {
 	if !errors.Is(err, expectedErr) {
 		t.Fatalf("expected commit error, got %v", err)
 	}
-	if !tx.committed {
-		t.Fatal("expected commit attempt")
+}
+
+func TestWithTxReturnsBeginError(t *testing.T) {
+	expectedErr := errors.New("begin failed")
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin().WillReturnError(expectedErr)
+
+	conn := primaryConn(t, p)
+
+	err := ds.WithTx(context.Background(), conn, func(context.Context, ds.Tx) error {
+		t.Fatal("callback must not run")
+		return nil
+	})
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected begin error, got %v", err)
+	}
+}
+
+func TestWithTxOptions(t *testing.T) {
+	opts := ds.TxOptions{
+		Isolation:  ds.IsolationSerializable,
+		AccessMode: ds.AccessReadOnly,
+		Deferrable: true,
+	}
+
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectBegin().WithOptions(opts)
+	p.ExpectQuery(`SELECT sum`)
+	p.ExpectCommit()
+
+	conn := primaryConn(t, p)
+
+	err := ds.WithTxOptions(context.Background(), conn, opts, func(ctx context.Context, tx ds.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT sum(amount) FROM payments")
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReadOptionsValidate(t *testing.T) {
+	valid := []ds.ReadOptions{
+		{},
+		{Consistency: ds.Strong},
+		{Consistency: ds.ReadYourWrites, MinLSN: 1},
+		{Consistency: ds.BoundedStaleness, MaxLag: time.Second},
+		{Consistency: ds.BoundedStaleness, MaxLagBytes: 1024},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Fatalf("%+v: unexpected error: %v", o, err)
+		}
+	}
+
+	invalid := []ds.ReadOptions{
+		{Consistency: ds.BoundedStaleness},
+		{Consistency: ds.BoundedStaleness, MaxLag: -time.Second},
+		{Consistency: ds.Consistency(42)},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); !errors.Is(err, ds.ErrInvalidReadOptions) {
+			t.Fatalf("%+v: expected ErrInvalidReadOptions, got %v", o, err)
+		}
 	}
-	if !tx.rolledBack {
-		t.Fatal("expected rollback after commit error")
+}
+
+func TestGetSecondaryFromWithoutConsistentReader(t *testing.T) {
+	p := dstest.New(t)
+	p.ExpectGetPrimary()
+	p.ExpectGetPrimary()
+	p.ExpectGetSecondary().WithMinLSN("")
+	p.ExpectGetSecondary().WithMinLSN("0/10")
+	p.ExpectGetSecondary().WithMinLSN("0/20")
+
+	ctx := ds.ContextWithConsistencyToken(ds.ContextWithProvider(context.Background(), p))
+	token, _ := ds.ConsistencyTokenFromContext(ctx)
+	token.Observe("0/20")
+
+	tests := []struct {
+		opts ds.ReadOptions
+		want ds.ServerID
+	}{
+		{ds.ReadOptions{Consistency: ds.Strong}, dstest.PrimaryID},
+		{ds.ReadOptions{Consistency: ds.BoundedStaleness, MaxLag: time.Second}, dstest.PrimaryID},
+		{ds.ReadOptions{Consistency: ds.Eventual}, dstest.SecondaryID},
+		{ds.ReadOptions{Consistency: ds.ReadYourWrites, MinLSN: 0x10}, dstest.SecondaryID},
+		// MinLSN defaults to the consistency token.
+		{ds.ReadOptions{Consistency: ds.ReadYourWrites}, dstest.SecondaryID},
+	}
+
+	for _, tt := range tests {
+		pc, id, err := ds.GetSecondaryWith(ctx, tt.opts)
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", tt.opts, err)
+		}
+		pc.Release()
+
+		if id != tt.want {
+			t.Fatalf("%+v: expected %s, got %s", tt.opts, tt.want, id)
+		}
 	}
 }